@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// extractionCacheDir holds the swatches of wallpapers that were already
+// quantized, keyed by the image's content and the extraction settings.
+var extractionCacheDir = filepath.Join(tm0dDir, "cache")
+
+const (
+	// extractionCacheVersion is part of every key. Bump it whenever the
+	// same image and settings would produce different swatches.
+	extractionCacheVersion = 3
+
+	// maxCacheEntries is how many extractions are kept; the least recently
+	// used ones are removed first.
+	maxCacheEntries = 100
+)
+
+var noCache bool
+
+// hashFile returns the SHA-256 of a file's content in hex. It tells a
+// wallpaper that was overwritten in place apart from the old one.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractionCacheKey combines the hash of an image's content with every
+// setting that changes what is extracted from it.
+func extractionCacheKey(contentHash string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00v%d quantizer=%s colors=%d pixels=%d",
+		contentHash, extractionCacheVersion, quantizerName, paletteSize, pixelBudget)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func extractionCachePath(key string) string {
+	return filepath.Join(homeDir, extractionCacheDir, key+".json")
+}
+
+// loadCachedSwatches returns the cached swatches for key, if any, and marks
+// the entry as recently used.
+func loadCachedSwatches(key string) ([]Swatch, bool) {
+	path := extractionCachePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var swatches []Swatch
+	if err := json.Unmarshal(data, &swatches); err != nil || len(swatches) == 0 {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return swatches, true
+}
+
+// storeCachedSwatches saves swatches under key and prunes the cache. The
+// entry is written to a temporary file first so readers never see half of it.
+func storeCachedSwatches(key string, swatches []Swatch) error {
+	dir := filepath.Join(homeDir, extractionCacheDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(swatches)
+	if err != nil {
+		return fmt.Errorf("failed to generate cache JSON: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), extractionCachePath(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	pruneExtractionCache(dir)
+	return nil
+}
+
+// pruneExtractionCache removes the least recently used entries beyond
+// maxCacheEntries.
+func pruneExtractionCache(dir string) {
+	entries, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(entries) <= maxCacheEntries {
+		return
+	}
+
+	used := make(map[string]time.Time, len(entries))
+	for _, path := range entries {
+		if info, err := os.Stat(path); err == nil {
+			used[path] = info.ModTime()
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return used[entries[i]].After(used[entries[j]])
+	})
+	for _, path := range entries[maxCacheEntries:] {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Named contrast levels accepted by --contrast.
+var contrastLevels = map[string]float64{
+	"reduced":  -1,
+	"standard": 0,
+	"medium":   0.5,
+	"high":     1,
+}
+
+// contrastCurve is the minimum contrast ratio of a role pair at contrast
+// levels -1, 0, 0.5 and 1. Levels in between are interpolated.
+type contrastCurve struct {
+	Low, Normal, Medium, High float64
+}
+
+// Standard contrast is WCAG AA: 4.5:1 for text, 3:1 for UI components.
+// High contrast goes beyond WCAG AAA.
+var (
+	textContrast       = contrastCurve{Low: 3, Normal: 4.5, Medium: 7, High: 11}
+	componentContrast  = contrastCurve{Low: 1.5, Normal: 3, Medium: 4.5, High: 7}
+	decorativeContrast = contrastCurve{Low: 1, Normal: 1.5, Medium: 3, High: 4.5}
+)
+
+func (c contrastCurve) at(level float64) float64 {
+	switch {
+	case level <= -1:
+		return c.Low
+	case level < 0:
+		return lerp(c.Low, c.Normal, level+1)
+	case level < 0.5:
+		return lerp(c.Normal, c.Medium, level/0.5)
+	case level < 1:
+		return lerp(c.Medium, c.High, (level-0.5)/0.5)
+	default:
+		return c.High
+	}
+}
+
+// ContrastResult is the contrast a foreground/background role pair achieved.
+type ContrastResult struct {
+	Pair   string  // e.g. "OnSurface/Surface"
+	Ratio  float64 // Achieved WCAG contrast ratio
+	Target float64 // Minimum ratio for the contrast level
+}
+
+// Met reports whether the pair reached its target.
+func (r ContrastResult) Met() bool {
+	return r.Ratio >= r.Target
+}
+
+// contrastPair is a foreground role drawn on a background role. Fg and Bg
+// are moved along their palettes to meet the pair's curve; Bg only moves
+// when Fg alone cannot get there.
+type contrastPair struct {
+	Name   string
+	Fg     *color.RGBA
+	FgPal  TonalPalette
+	Bg     *color.RGBA
+	BgPal  TonalPalette
+	Curve  contrastCurve
+	MoveBg bool
+}
+
+// parseContrastLevel accepts a named level or a number between -1 and 1.
+func parseContrastLevel(value string) (float64, error) {
+	if level, ok := contrastLevels[value]; ok {
+		return level, nil
+	}
+	level, err := strconv.ParseFloat(value, 64)
+	if err != nil || level < -1 || level > 1 {
+		return 0, fmt.Errorf("unknown --contrast %q, expected reduced, standard, medium, high or a number from -1 to 1", value)
+	}
+	return level, nil
+}
+
+// contrastLevelName describes a level for output.
+func contrastLevelName(level float64) string {
+	for name, l := range contrastLevels {
+		if l == level {
+			return name
+		}
+	}
+	return strconv.FormatFloat(level, 'f', -1, 64)
+}
+
+// contrastRatio is the WCAG contrast ratio between two colors.
+func contrastRatio(a, b color.RGBA) float64 {
+	return ratioOfYs(rgbToXyz(a)[1], rgbToXyz(b)[1])
+}
+
+func ratioOfYs(y1, y2 float64) float64 {
+	lighter, darker := math.Max(y1, y2), math.Min(y1, y2)
+	return (lighter + 5) / (darker + 5)
+}
+
+// lighterTone is the tone that has ratio against tone, or -1 if it would
+// have to be brighter than white.
+func lighterTone(tone, ratio float64) float64 {
+	y := ratio*(yFromLstar(tone)+5) - 5
+	if y > 100 {
+		return -1
+	}
+	return lstarFromY(y)
+}
+
+// darkerTone is the tone that has ratio against tone, or -1 if it would
+// have to be darker than black.
+func darkerTone(tone, ratio float64) float64 {
+	y := (yFromLstar(tone)+5)/ratio - 5
+	if y < 0 {
+		return -1
+	}
+	return lstarFromY(y)
+}
+
+// toneOf is a color's HCT tone, which is its L*.
+func toneOf(c color.RGBA) float64 {
+	return lstarFromY(rgbToXyz(c)[1])
+}
+
+// applyContrast moves the roles of theme until every pair meets the
+// ratio the contrast level asks for, and returns the achieved ratios.
+// Targets are minimums: pairs that already meet them keep their tones.
+func applyContrast(theme *ClassifiedTheme, level float64) []ContrastResult {
+	pairs := themeContrastPairs(theme)
+	for _, pair := range pairs {
+		ensureContrast(pair, pair.Curve.at(level))
+	}
+	separateTerminalBrights(theme)
+
+	results := make([]ContrastResult, 0, len(pairs))
+	for _, pair := range pairs {
+		results = append(results, ContrastResult{
+			Pair:   pair.Name,
+			Ratio:  contrastRatio(*pair.Fg, *pair.Bg),
+			Target: pair.Curve.at(level),
+		})
+	}
+
+	// Roles that mirror others follow them.
+	theme.Background = theme.Surface
+	theme.OnBackground = theme.OnSurface
+	theme.SurfaceTint = theme.PrimaryRoles.Color
+	return results
+}
+
+// ensureContrast moves the pair's foreground to the target ratio when it
+// falls short, keeping it on the same side of the background.
+func ensureContrast(pair contrastPair, target float64) {
+	if contrastRatio(*pair.Fg, *pair.Bg) >= target {
+		return
+	}
+
+	fgTone, bgTone := toneOf(*pair.Fg), toneOf(*pair.Bg)
+	lighter := fgTone >= bgTone
+
+	tone := darkerTone(bgTone, target)
+	if lighter {
+		tone = lighterTone(bgTone, target)
+	}
+	if tone >= 0 {
+		*pair.Fg = nudgeToContrast(pair.FgPal, tone, *pair.Bg, target, lighter)
+		return
+	}
+
+	// The foreground can't get there on its own: take the extreme and move
+	// the background away from it.
+	fgTone = 0
+	if lighter {
+		fgTone = 100
+	}
+	*pair.Fg = pair.FgPal.Tone(fgTone)
+	if !pair.MoveBg {
+		return
+	}
+	bgTone = lighterTone(fgTone, target)
+	if lighter {
+		bgTone = darkerTone(fgTone, target)
+	}
+	*pair.Bg = nudgeToContrast(pair.BgPal, math.Max(bgTone, 0), *pair.Fg, target, !lighter)
+}
+
+// nudgeToContrast returns the palette color at tone, stepping it further
+// away from other while rounding to 8-bit channels leaves it short of the
+// target ratio.
+func nudgeToContrast(p TonalPalette, tone float64, other color.RGBA, target float64, lighter bool) color.RGBA {
+	step := -0.25
+	if lighter {
+		step = 0.25
+	}
+	c := p.Tone(tone)
+	for contrastRatio(c, other) < target && tone > 0 && tone < 100 {
+		tone = math.Min(math.Max(tone+step, 0), 100)
+		c = p.Tone(tone)
+	}
+	return c
+}
+
+// themeContrastPairs lists the role pairs of theme that must stay legible,
+// backgrounds before the roles drawn on them.
+func themeContrastPairs(t *ClassifiedTheme) []contrastPair {
+	pairs := []contrastPair{
+		{"OnSurface/Surface", &t.OnSurface, t.Neutral, &t.Surface, t.Neutral, textContrast, false},
+		{"OnSurfaceVariant/SurfaceVariant", &t.OnSurfaceVariant, t.NeutralVariant, &t.SurfaceVariant, t.NeutralVariant, textContrast, true},
+		{"Outline/Surface", &t.Outline, t.NeutralVariant, &t.Surface, t.Neutral, componentContrast, false},
+		{"OutlineVariant/Surface", &t.OutlineVariant, t.NeutralVariant, &t.Surface, t.Neutral, decorativeContrast, false},
+		{"InverseOnSurface/InverseSurface", &t.InverseOnSurface, t.Neutral, &t.InverseSurface, t.Neutral, textContrast, true},
+		{"InversePrimary/InverseSurface", &t.InversePrimary, t.Primary, &t.InverseSurface, t.Neutral, componentContrast, false},
+	}
+
+	// Role names of each accent: Color, OnColor, Container, OnContainer
+	type accent struct {
+		names   [4]string
+		roles   *ColorRoles
+		palette TonalPalette
+	}
+	builtin := func(name string) [4]string {
+		return [4]string{name, "On" + name, name + "Container", "On" + name + "Container"}
+	}
+	accents := []accent{
+		{builtin("Primary"), &t.PrimaryRoles, t.Primary},
+		{builtin("Secondary"), &t.SecondaryRoles, t.Secondary},
+		{builtin("Tertiary"), &t.TertiaryRoles, t.Tertiary},
+		{builtin("Error"), &t.ErrorRoles, t.Error},
+	}
+	for _, name := range customColorNames(t.Custom) {
+		custom := t.Custom[name]
+		prefix := "Custom." + name + "."
+		names := [4]string{prefix + "Color", prefix + "OnColor", prefix + "Container", prefix + "OnContainer"}
+		accents = append(accents, accent{names, &custom.ColorRoles, custom.Palette})
+	}
+	for _, a := range accents {
+		pairs = append(pairs,
+			contrastPair{a.names[0] + "/Surface", &a.roles.Color, a.palette, &t.Surface, t.Neutral, componentContrast, false},
+			contrastPair{a.names[1] + "/" + a.names[0], &a.roles.OnColor, a.palette, &a.roles.Color, a.palette, textContrast, true},
+			contrastPair{a.names[3] + "/" + a.names[2], &a.roles.OnContainer, a.palette, &a.roles.Container, a.palette, textContrast, true},
+		)
+	}
+
+	fixed := []struct {
+		name                      string
+		fixed, onFixed, onVariant *color.RGBA
+		palette                   TonalPalette
+	}{
+		{"Primary", &t.PrimaryFixed, &t.OnPrimaryFixed, &t.OnPrimaryFixedVariant, t.Primary},
+		{"Secondary", &t.SecondaryFixed, &t.OnSecondaryFixed, &t.OnSecondaryFixedVariant, t.Secondary},
+		{"Tertiary", &t.TertiaryFixed, &t.OnTertiaryFixed, &t.OnTertiaryFixedVariant, t.Tertiary},
+	}
+	for _, f := range fixed {
+		pairs = append(pairs,
+			contrastPair{"On" + f.name + "Fixed/" + f.name + "Fixed", f.onFixed, f.palette, f.fixed, f.palette, textContrast, true},
+			contrastPair{"On" + f.name + "FixedVariant/" + f.name + "Fixed", f.onVariant, f.palette, f.fixed, f.palette, textContrast, true},
+		)
+	}
+	return append(pairs, terminalContrastPairs(t)...)
+}
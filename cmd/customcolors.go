@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// customColorsFile maps names to colors templates can use alongside the
+// theme, e.g. {"warning": "#ffb86c", "git_added": "#50fa7b"}.
+var customColorsFile = filepath.Join(tm0dDir, "customcolors.json")
+
+// customColorName keeps names usable as .Theme.Custom.<name> in templates.
+var customColorName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// CustomColor is a user-defined color harmonized to the theme, with the
+// same roles as the accent colors.
+type CustomColor struct {
+	ColorRoles
+	Palette TonalPalette
+}
+
+// loadCustomColors reads the custom colors file. A missing file means no
+// custom colors.
+func loadCustomColors() (map[string]color.RGBA, error) {
+	path := filepath.Join(homeDir, customColorsFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read custom colors: %w", err)
+	}
+
+	var hexes map[string]string
+	if err := json.Unmarshal(data, &hexes); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	colors := make(map[string]color.RGBA, len(hexes))
+	for name, hex := range hexes {
+		if !customColorName.MatchString(name) {
+			return nil, fmt.Errorf("custom color name %q must start with a letter and contain only letters, digits and _", name)
+		}
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("custom color %s: %w", name, err)
+		}
+		colors[name] = c
+	}
+	return colors, nil
+}
+
+// customPalettes harmonizes every custom color's hue toward the primary
+// and expands it into a tonal palette, keeping its own chroma.
+func customPalettes(colors map[string]color.RGBA, primaryHue float64) map[string]TonalPalette {
+	palettes := make(map[string]TonalPalette, len(colors))
+	for name, c := range colors {
+		hct := rgbToHct(c)
+		hct.H = harmonizeHue(hct.H, primaryHue)
+		palettes[name] = generateTonalPaletteHct(hct)
+	}
+	return palettes
+}
+
+// customColorNames returns the names of custom colors in a stable order.
+func customColorNames(custom map[string]*CustomColor) []string {
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
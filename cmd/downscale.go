@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// defaultPixelBudget is how many pixels images are scaled down to before
+// quantization, about a 340x190 thumbnail of a 16:9 wallpaper.
+const defaultPixelBudget = 1 << 16
+
+// pixelBudget is set with --pixel-budget; 0 quantizes at full resolution.
+var pixelBudget int
+
+// downscale shrinks img to at most budget pixels, keeping its aspect ratio.
+// Every output pixel is the average of the source pixels it covers, so
+// small details still count toward the colors in proportion to their area.
+func downscale(img image.Image, budget int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if budget <= 0 || srcW*srcH <= budget {
+		return img
+	}
+
+	scale := math.Sqrt(float64(budget) / float64(srcW*srcH))
+	dstW := max(1, int(float64(srcW)*scale))
+	dstH := max(1, int(float64(srcH)*scale))
+
+	// Premultiplied 16-bit channel sums and pixel counts per output pixel
+	sums := make([][4]uint64, dstW*dstH)
+	counts := make([]uint32, dstW*dstH)
+	columns := make([]int, srcW)
+	for x := range columns {
+		columns[x] = x * dstW / srcW
+	}
+
+	add := func(x, y int, r, g, b, a uint32) {
+		i := (y*dstH/srcH)*dstW + columns[x]
+		sums[i][0] += uint64(r)
+		sums[i][1] += uint64(g)
+		sums[i][2] += uint64(b)
+		sums[i][3] += uint64(a)
+		counts[i]++
+	}
+
+	// Decoders return concrete types whose pixels can be read without
+	// going through color.Color for every pixel.
+	switch src := img.(type) {
+	case *image.YCbCr:
+		for y := 0; y < srcH; y++ {
+			for x := 0; x < srcW; x++ {
+				yi := src.YOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				ci := src.COffset(bounds.Min.X+x, bounds.Min.Y+y)
+				r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+				add(x, y, uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101, 0xffff)
+			}
+		}
+	case *image.RGBA:
+		for y := 0; y < srcH; y++ {
+			row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+			for x := 0; x < srcW; x++ {
+				p := row[x*4 : x*4+4]
+				add(x, y, uint32(p[0])*0x101, uint32(p[1])*0x101, uint32(p[2])*0x101, uint32(p[3])*0x101)
+			}
+		}
+	default:
+		for y := 0; y < srcH; y++ {
+			for x := 0; x < srcW; x++ {
+				r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				add(x, y, r, g, b, a)
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for i, sum := range sums {
+		n := uint64(max(counts[i], 1))
+		dst.Pix[i*4+0] = uint8((sum[0] / n) >> 8)
+		dst.Pix[i*4+1] = uint8((sum[1] / n) >> 8)
+		dst.Pix[i*4+2] = uint8((sum[2] / n) >> 8)
+		dst.Pix[i*4+3] = uint8((sum[3] / n) >> 8)
+	}
+	return dst
+}
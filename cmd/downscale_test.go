@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"image"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var (
+	benchWallpaperOnce sync.Once
+	benchWallpaper     *image.RGBA
+)
+
+// largeWallpaper returns a 6000x4000 image of soft gradients sprinkled
+// with noise, so there are many distinct colors to quantize like in a photo.
+func largeWallpaper() *image.RGBA {
+	benchWallpaperOnce.Do(func() {
+		const w, h = 6000, 4000
+		rng := rand.New(rand.NewSource(1))
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := img.PixOffset(x, y)
+				noise := rng.Intn(24)
+				img.Pix[i+0] = uint8(x*200/w + noise)
+				img.Pix[i+1] = uint8(y*160/h + noise)
+				img.Pix[i+2] = uint8((x+y)*120/(w+h) + 80 + noise)
+				img.Pix[i+3] = 255
+			}
+		}
+		benchWallpaper = img
+	})
+	return benchWallpaper
+}
+
+// benchmarkExtract runs every quantizer on the large wallpaper after scaling
+// it to budget, the way getDominantColors does; 0 quantizes every pixel.
+func benchmarkExtract(b *testing.B, budget int) {
+	img := largeWallpaper()
+	for _, q := range quantizers {
+		b.Run(q.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := q.quantize(downscale(img, budget), paletteSize); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExtractFullResolution(b *testing.B) {
+	benchmarkExtract(b, 0)
+}
+
+func BenchmarkExtractPixelBudget(b *testing.B) {
+	benchmarkExtract(b, defaultPixelBudget)
+}
+
+func TestDownscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3000, 2000))
+
+	small := downscale(img, defaultPixelBudget)
+	bounds := small.Bounds()
+	if pixels := bounds.Dx() * bounds.Dy(); pixels > defaultPixelBudget || pixels < defaultPixelBudget*9/10 {
+		t.Errorf("downscaled to %dx%d = %d pixels, want just under %d", bounds.Dx(), bounds.Dy(), pixels, defaultPixelBudget)
+	}
+	if ratio := float64(bounds.Dx()) / float64(bounds.Dy()); ratio < 1.45 || ratio > 1.55 {
+		t.Errorf("aspect ratio changed to %.2f, want 1.5", ratio)
+	}
+
+	if downscale(img, 0) != image.Image(img) {
+		t.Error("a budget of 0 should keep the image as it is")
+	}
+	if downscale(img, 3000*2000) != image.Image(img) {
+		t.Error("an image within the budget should be kept as it is")
+	}
+}
@@ -1,21 +1,21 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	// Blank imports for image decoding
 	_ "image/jpeg"
 	_ "image/png"
 
-	"github.com/cascax/colorthief-go"
 	"github.com/spf13/cobra"
 )
 
@@ -27,7 +27,32 @@ var generateCmd = &cobra.Command{
 
 type WallpaperInfo struct {
 	WallpaperPath string       `json:"wallpaper_location"`
-	Palletes      []color.RGBA `json:"palletes"`
+	WallpaperHash string       `json:"wallpaper_hash,omitempty"` // SHA-256 of the image the colors came from
+	Colors        []color.RGBA `json:"colors"`
+	Swatches      []Swatch     `json:"swatches,omitempty"` // Colors with their populations
+	Seed          string       `json:"seed,omitempty"`     // Hex color forcing the primary seed
+}
+
+// Swatch is an extracted color with how much of the wallpaper it covers.
+type Swatch struct {
+	Color      color.RGBA `json:"color"`
+	Population int        `json:"population"` // Sampled pixels closest to Color
+	Proportion float64    `json:"proportion"` // Population as a share of all swatches
+	HCT        HCT        `json:"hct"`
+	Score      float64    `json:"score"` // Material's Score: hue coverage and chroma
+}
+
+// colorSwatches returns the swatches of the wallpaper. Theme files written
+// before swatches were recorded only have colors, with no population.
+func (w WallpaperInfo) colorSwatches() []Swatch {
+	if len(w.Swatches) > 0 {
+		return w.Swatches
+	}
+	swatches := make([]Swatch, 0, len(w.Colors))
+	for _, c := range w.Colors {
+		swatches = append(swatches, Swatch{Color: c, HCT: rgbToHct(c)})
+	}
+	return swatches
 }
 
 type MonitorInfo struct {
@@ -37,49 +62,100 @@ type MonitorInfo struct {
 
 var homeDir string
 
+var (
+	imagePaths   []string
+	imageMonitor []string
+	seedColors   []string
+	generatePin  bool
+
+	quantizerName string
+	extractJobs   int
+)
+
 const tm0dDir string = "Templates/ThemeM0d"
 
 var themeFileDir = filepath.Join(tm0dDir, "currenttheme.tm0d")
 
+// paletteSize is how many colors are extracted from each wallpaper.
+const paletteSize = 12
+
 func init() {
 	homeDir = os.Getenv("HOME")
 	rootCmd.AddCommand(generateCmd)
+	generateCmd.Flags().StringVar(&wallpaperSourceName, "source", "auto",
+		"wallpaper daemon to query: auto, "+strings.Join(wallpaperSourceNames(), ", "))
+	generateCmd.Flags().StringArrayVar(&imagePaths, "image", nil,
+		"generate from this image instead of the active wallpaper (repeatable)")
+	generateCmd.Flags().StringArrayVar(&imageMonitor, "monitor", nil,
+		"monitor name for the matching --image (defaults to the image file name)")
+	generateCmd.Flags().StringArrayVar(&seedColors, "seed", nil,
+		"force the primary seed: '#rrggbb' for every monitor or 'MONITOR=#rrggbb' (repeatable)")
+	generateCmd.Flags().BoolVar(&generatePin, "pin", false,
+		"pin the generated theme in the history so it is never pruned")
+	addExtractionFlags(generateCmd)
 }
 
-func getWallpaper() (map[string]string, error) {
-	cmd := exec.Command("hyprctl", "hyprpaper", "listactive")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("EROR: Could not get wallpaper: %w", err)
-	}
-
-	wallpapers := make(map[string]string)
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+// addExtractionFlags registers the flags of every command that extracts
+// colors from wallpapers.
+func addExtractionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&quantizerName, "quantizer", defaultQuantizer,
+		"color quantizer: "+strings.Join(quantizerNames(), ", "))
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"extract colors again instead of reusing the cached result for a known image")
+	cmd.Flags().IntVar(&pixelBudget, "pixel-budget", defaultPixelBudget,
+		"scale images down to about this many pixels before quantizing (0 keeps full resolution)")
+	cmd.Flags().IntVar(&extractJobs, "jobs", runtime.NumCPU(),
+		"how many wallpapers to extract colors from at once")
+}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
+// validateExtractionFlags checks the flags added by addExtractionFlags.
+func validateExtractionFlags() error {
+	if _, err := findQuantizer(quantizerName); err != nil {
+		return err
+	}
+	if pixelBudget < 0 {
+		return fmt.Errorf("--pixel-budget must not be negative")
+	}
+	if extractJobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	return nil
+}
 
-		monitorName := strings.TrimSpace(parts[0])
-		wallpaperPath := strings.TrimSpace(parts[1])
+func getWallpaper() (map[string]string, string, error) {
+	source, err := resolveWallpaperSource(wallpaperSourceName)
+	if err != nil {
+		return nil, "", fmt.Errorf("EROR: Could not get wallpaper: %w", err)
+	}
 
-		wallpapers[monitorName] = wallpaperPath
+	wallpapers, err := source.Wallpapers()
+	if err != nil {
+		return nil, "", fmt.Errorf("EROR: Could not get wallpaper from %s: %w", source.Name(), err)
 	}
 
 	if len(wallpapers) == 0 {
-		return nil, fmt.Errorf("No Wallpapers Found")
+		return nil, "", fmt.Errorf("No Wallpapers Found")
 	}
 
-	return wallpapers, nil
+	return wallpapers, source.Name(), nil
 }
 
-func getDominantColors(imagePath string) ([]color.Color, error) {
+// getDominantColors extracts the swatches of an image, or reuses them from
+// the extraction cache when the same image was seen with the same settings.
+// contentHash is the image's hashFile.
+func getDominantColors(imagePath, contentHash string) ([]Swatch, error) {
+	q, err := findQuantizer(quantizerName)
+	if err != nil {
+		return nil, err
+	}
+
+	key := extractionCacheKey(contentHash)
+	if !noCache {
+		if swatches, ok := loadCachedSwatches(key); ok {
+			return swatches, nil
+		}
+	}
+
 	file, err := os.Open(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image: %w", err)
@@ -91,12 +167,77 @@ func getDominantColors(imagePath string) ([]color.Color, error) {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	palette, err := colorthief.GetPalette(img, 12)
+	swatches, err := q.quantize(downscale(img, pixelBudget), paletteSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get palette: %w", err)
 	}
 
-	return palette, nil
+	describeSwatches(swatches)
+	if err := storeCachedSwatches(key, swatches); err != nil {
+		log.Printf("WARNING: Could not cache colors of %s: %v", imagePath, err)
+	}
+	return swatches, nil
+}
+
+// parseHexColor parses a #rrggbb or #rgb color; the # is optional.
+func parseHexColor(hex string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+
+	var r, g, b uint8
+	if len(digits) != 6 {
+		return color.RGBA{}, fmt.Errorf("%q is not a #rrggbb color", hex)
+	}
+	if _, err := fmt.Sscanf(digits, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return color.RGBA{}, fmt.Errorf("%q is not a #rrggbb color", hex)
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+}
+
+// parseSeedFlags maps each --seed to its monitor. A seed without a monitor
+// is stored under "" and applies to every monitor.
+func parseSeedFlags(values []string) (map[string]string, error) {
+	seeds := make(map[string]string)
+	for _, value := range values {
+		monitor, hex, found := strings.Cut(value, "=")
+		if !found {
+			monitor, hex = "", value
+		}
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, err
+		}
+		seeds[monitor] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return seeds, nil
+}
+
+// getImageWallpapers pairs each --image with its --monitor by position, so
+// themes can be generated without a running compositor.
+func getImageWallpapers(images, monitors []string) (map[string]string, error) {
+	if len(monitors) > len(images) {
+		return nil, fmt.Errorf("got %d --monitor names for %d --image paths", len(monitors), len(images))
+	}
+
+	wallpapers := make(map[string]string)
+	for i, path := range images {
+		absPath, err := filepath.Abs(expandHome(path))
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve image path %s: %w", path, err)
+		}
+
+		monitor := strings.TrimSuffix(filepath.Base(absPath), filepath.Ext(absPath))
+		if i < len(monitors) {
+			monitor = monitors[i]
+		}
+		if _, exists := wallpapers[monitor]; exists {
+			return nil, fmt.Errorf("monitor %s was given more than one image", monitor)
+		}
+		wallpapers[monitor] = absPath
+	}
+	return wallpapers, nil
 }
 
 func DoesThemeM0dFolderExist() (bool, error) {
@@ -111,65 +252,132 @@ func DoesThemeM0dFolderExist() (bool, error) {
 }
 
 func GenerateThemeFile(cmd *cobra.Command, args []string) {
-	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") == "" {
-		fmt.Println("This only works with arch hyprland")
-		return
-	}
-
-	wallpapers, err := getWallpaper()
+	seeds, err := parseSeedFlags(seedColors)
 	if err != nil {
-		log.Fatalf("ERROR: Could not get wallpaper: %s", err)
+		log.Fatalf("ERROR: Invalid --seed: %s", err)
+	}
+	if err := validateExtractionFlags(); err != nil {
+		log.Fatalf("ERROR: %s", err)
 	}
 
-	themeDir := filepath.Join(homeDir, "Templates/ThemeM0d")
-	if exists, err := DoesThemeM0dFolderExist(); err != nil {
-		log.Fatalf("Error checking folder: %v", err)
-	} else if !exists {
-		err := os.MkdirAll(themeDir, 0755)
+	var wallpapers map[string]string
+	source := imageSourceName
+	if len(imagePaths) > 0 {
+		wallpapers, err = getImageWallpapers(imagePaths, imageMonitor)
 		if err != nil {
-			log.Fatalf("ERROR: An eror occured trying to make ThemeM0d Directory: %s", err)
+			log.Fatalf("ERROR: Invalid --image arguments: %s", err)
+		}
+	} else {
+		if len(imageMonitor) > 0 {
+			log.Fatalf("ERROR: --monitor can only be used together with --image")
+		}
+		wallpapers, source, err = getWallpaper()
+		if err != nil {
+			log.Fatalf("ERROR: Could not get wallpaper: %s", err)
+		}
+	}
+
+	allMonitorsInfo := extractMonitors(wallpapers)
+	for i := range allMonitorsInfo {
+		info := &allMonitorsInfo[i]
+		if seed, ok := seeds[info.Monitor]; ok {
+			info.Theme.Seed = seed
+		} else {
+			info.Theme.Seed = seeds[""]
+		}
+	}
+
+	for monitor := range seeds {
+		if _, ok := wallpapers[monitor]; monitor != "" && !ok {
+			log.Printf("WARNING: --seed for unknown monitor %s was ignored.", monitor)
 		}
 	}
 
-	var allMonitorsInfo []MonitorInfo
+	outputFile, id, err := writeThemeFile(allMonitorsInfo, source)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+
+	fmt.Printf("Successfully generated theme file at: %s\n", outputFile)
+	if generatePin {
+		if id == "" {
+			log.Printf("ERROR: Could not pin the theme, it was not saved to history.")
+		} else {
+			setHistoryPin(id, true)
+		}
+	}
+}
 
+// extractMonitors extracts the colors of every monitor's wallpaper on up to
+// --jobs workers, and returns the monitors that succeeded sorted by name.
+// Monitors showing the same wallpaper share one extraction.
+func extractMonitors(wallpapers map[string]string) []MonitorInfo {
+	monitorsByPath := make(map[string][]string)
 	for monitor, path := range wallpapers {
-		fmt.Printf("Processing wallpaper for monitor %s: %s\n", monitor, path)
-		colors, err := getDominantColors(path)
-
-		// We need to convert color.Color to color.RGBA
-		rgbaPalette := make([]color.RGBA, 0, len(colors))
-		for _, c := range colors {
-			if rgba, ok := c.(color.RGBA); ok {
-				rgbaPalette = append(rgbaPalette, rgba)
+		monitorsByPath[path] = append(monitorsByPath[path], monitor)
+	}
+	paths := make([]string, 0, len(monitorsByPath))
+	for path, monitors := range monitorsByPath {
+		sort.Strings(monitors)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	results := make([]*WallpaperInfo, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(extractJobs, len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				theme, err := extractWallpaperInfo(paths[i], monitorsByPath[paths[i]])
+				if err != nil {
+					log.Printf("Could not process wallpaper %s: %v. Skipping.", paths[i], err)
+					continue
+				}
+				results[i] = &theme
 			}
-		}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-		if err != nil {
-			log.Printf("Could not process wallpaper %s: %v. Skipping.", path, err)
+	var infos []MonitorInfo
+	for i, theme := range results {
+		if theme == nil {
 			continue
 		}
-
-		info := MonitorInfo{
-			Monitor: monitor,
-			Theme: WallpaperInfo{
-				WallpaperPath: path,
-				Palletes:      rgbaPalette,
-			},
+		for _, monitor := range monitorsByPath[paths[i]] {
+			infos = append(infos, MonitorInfo{Monitor: monitor, Theme: *theme})
 		}
-		allMonitorsInfo = append(allMonitorsInfo, info)
 	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Monitor < infos[j].Monitor
+	})
+	return infos
+}
 
-	jsonData, err := json.MarshalIndent(allMonitorsInfo, "", "  ")
+// extractWallpaperInfo extracts the dominant colors of the wallpaper shown
+// on monitors.
+func extractWallpaperInfo(path string, monitors []string) (WallpaperInfo, error) {
+	fmt.Printf("Processing wallpaper for monitor %s: %s\n", strings.Join(monitors, ", "), path)
+	hash, err := hashFile(path)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to generate JSON: %v", err)
+		return WallpaperInfo{}, fmt.Errorf("failed to open image: %w", err)
 	}
-
-	outputFile := filepath.Join(themeDir, "currenttheme.tm0d")
-	err = os.WriteFile(outputFile, jsonData, 0644)
+	swatches, err := getDominantColors(path, hash)
 	if err != nil {
-		log.Fatalf("ERROR: Failed to write theme file: %v", err)
+		return WallpaperInfo{}, err
 	}
 
-	fmt.Printf("Successfully generated theme file at: %s\n", outputFile)
+	return WallpaperInfo{
+		WallpaperPath: path,
+		WallpaperHash: hash,
+		Colors:        swatchColors(swatches),
+		Swatches:      swatches,
+	}, nil
 }
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// globalThemeName is the directory under Themes/ and the .Monitor of the
+// theme shared by all monitors.
+const globalThemeName = "global"
+
+// Template scopes, chosen with a {{/* scope: global */}} comment in the
+// template.
+const (
+	scopeMonitor = "monitor" // Rendered for every monitor, the default
+	scopeGlobal  = "global"  // Rendered once into Themes/global/
+	scopeBoth    = "both"
+)
+
+var templateScopeDirective = regexp.MustCompile(`\{\{-?\s*/\*\s*scope:\s*(\w+)\s*\*/\s*-?\}\}`)
+
+// globalFrom is set with --global-from. Empty merges every monitor.
+var globalFrom string
+
+// templateScope reads the scope directive of a template. Templates without
+// one are rendered per monitor.
+func templateScope(templatesDir, templateName string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(templatesDir, templateName))
+	if err != nil {
+		return scopeMonitor, err
+	}
+	match := templateScopeDirective.FindSubmatch(content)
+	if match == nil {
+		return scopeMonitor, nil
+	}
+	switch scope := string(match[1]); scope {
+	case scopeMonitor, scopeGlobal, scopeBoth:
+		return scope, nil
+	default:
+		return scopeMonitor, fmt.Errorf("unknown scope %q in %s, expected monitor, global or both", scope, templateName)
+	}
+}
+
+// splitTemplateScopes sorts templates into those rendered per monitor and
+// those rendered for the global theme. Templates with both scopes are in
+// both lists.
+func splitTemplateScopes(templatesDir string, templateNames []string) (monitor, global []string) {
+	for _, name := range templateNames {
+		scope, err := templateScope(templatesDir, name)
+		if err != nil {
+			fmt.Printf("WARNING: %v\n", err)
+		}
+		if scope != scopeGlobal {
+			monitor = append(monitor, name)
+		}
+		if scope != scopeMonitor {
+			global = append(global, name)
+		}
+	}
+	return monitor, global
+}
+
+// globalMonitorInfo returns the palette of the global theme: the monitor
+// chosen with --global-from, or the swatches of every monitor merged. Each
+// monitor counts by its area in pixels, see monitorWeights, and its colors
+// by how much of its wallpaper they cover.
+func globalMonitorInfo(monitors []MonitorInfo) (MonitorInfo, error) {
+	for _, m := range monitors {
+		if m.Monitor == globalThemeName {
+			return MonitorInfo{}, fmt.Errorf("a monitor is named %q, which is reserved for the global theme", globalThemeName)
+		}
+	}
+
+	if globalFrom != "" {
+		for _, m := range monitors {
+			if m.Monitor == globalFrom {
+				m.Monitor = globalThemeName
+				return m, nil
+			}
+		}
+		return MonitorInfo{}, fmt.Errorf("--global-from monitor %s is not in the theme file", globalFrom)
+	}
+	if len(monitors) == 0 {
+		return MonitorInfo{}, fmt.Errorf("no monitors to build the global theme from")
+	}
+
+	monitorWeight := monitorWeights(monitors, hyprMonitorAreas())
+	weights := make(map[color.RGBA]float64)
+	seeds := make(map[string]bool)
+	for i, m := range monitors {
+		swatches := m.Theme.colorSwatches()
+		for _, s := range swatches {
+			share := s.Proportion
+			if share == 0 {
+				// Theme files without populations weigh colors evenly
+				share = 1 / float64(len(swatches))
+			}
+			weights[s.Color] += share * monitorWeight[i]
+		}
+		seeds[m.Theme.Seed] = true
+	}
+
+	merged := make([]Swatch, 0, len(weights))
+	for c, weight := range weights {
+		merged = append(merged, Swatch{Color: c, Proportion: weight, HCT: rgbToHct(c)})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Proportion != merged[j].Proportion {
+			return merged[i].Proportion > merged[j].Proportion
+		}
+		return rgbKey(merged[i].Color) < rgbKey(merged[j].Color)
+	})
+
+	info := MonitorInfo{
+		Monitor: globalThemeName,
+		Theme:   WallpaperInfo{Colors: swatchColors(merged), Swatches: merged},
+	}
+	// A seed only carries over when every monitor agrees on it
+	if len(seeds) == 1 {
+		info.Theme.Seed = monitors[0].Theme.Seed
+	}
+	return info, nil
+}
+
+// monitorWeights returns how much each monitor counts in the merged global
+// palette: its share of the total area in pixels. When any monitor has no
+// known size, such as the "all" output of daemons that don't name monitors
+// or the monitors of --image, every monitor counts equally instead.
+func monitorWeights(monitors []MonitorInfo, areas map[string]int) []float64 {
+	weights := make([]float64, len(monitors))
+	total := 0
+	for _, m := range monitors {
+		area := areas[m.Monitor]
+		if area <= 0 {
+			total = 0
+			break
+		}
+		total += area
+	}
+	for i, m := range monitors {
+		if total == 0 {
+			weights[i] = 1 / float64(len(monitors))
+		} else {
+			weights[i] = float64(areas[m.Monitor]) / float64(total)
+		}
+	}
+	return weights
+}
+
+// hyprMonitorAreas returns the size in pixels of every monitor Hyprland
+// knows, or nil outside Hyprland.
+func hyprMonitorAreas() map[string]int {
+	client, err := NewHyprlandClient()
+	if err != nil {
+		return nil
+	}
+	monitors, err := client.Monitors()
+	if err != nil {
+		return nil
+	}
+	areas := make(map[string]int, len(monitors))
+	for _, m := range monitors {
+		areas[m.Name] = m.Width * m.Height
+	}
+	return areas
+}
+
+// buildGlobalTheme renders the templates scoped to the global theme into
+// Themes/global/. Nothing is rendered when no template asks for it.
+func buildGlobalTheme(monitors []MonitorInfo, opts classifyOptions) error {
+	templatesDir := filepath.Join(homeDir, tm0dDir, "Templates")
+	templateNames, err := listTemplates(templatesDir)
+	if err != nil {
+		return err
+	}
+	_, global := splitTemplateScopes(templatesDir, templateNames)
+	if len(global) == 0 {
+		return nil
+	}
+
+	info, err := globalMonitorInfo(monitors)
+	if err != nil {
+		return err
+	}
+	source := "merged from " + strings.Join(monitorNames(monitors), ", ")
+	if globalFrom != "" {
+		source = "from " + globalFrom
+	}
+	fmt.Printf("\nProcessing templates for the global theme (%s)\n", source)
+
+	targets, err := monitorRenderTargets(info, opts)
+	if err != nil {
+		return err
+	}
+	renderMonitorTargets(templatesDir, global, globalThemeName, targets, opts)
+	return nil
+}
+
+func monitorNames(monitors []MonitorInfo) []string {
+	names := make([]string, len(monitors))
+	for i, m := range monitors {
+		names[i] = m.Monitor
+	}
+	return names
+}
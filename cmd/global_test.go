@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMonitorWeights(t *testing.T) {
+	monitors := []MonitorInfo{{Monitor: "DP-1"}, {Monitor: "HDMI-A-1"}}
+
+	tests := []struct {
+		name  string
+		areas map[string]int
+		want  []float64
+	}{
+		{"by area", map[string]int{"DP-1": 3840 * 2160, "HDMI-A-1": 1920 * 1080}, []float64{0.8, 0.2}},
+		{"same size", map[string]int{"DP-1": 2560 * 1440, "HDMI-A-1": 2560 * 1440}, []float64{0.5, 0.5}},
+		{"unknown monitor", map[string]int{"DP-1": 3840 * 2160, "all": 1920 * 1080}, []float64{0.5, 0.5}},
+		{"no geometry", nil, []float64{0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := monitorWeights(monitors, tt.areas)
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("weights = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
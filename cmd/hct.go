@@ -0,0 +1,574 @@
+package cmd
+
+import (
+	"image/color"
+	"math"
+)
+
+// This file implements CAM16 and the HCT color space as defined by Material
+// Color Utilities: hue and chroma come from CAM16 under the default viewing
+// conditions, tone is CIE L*.
+
+// HCT represents a color in Hue, Chroma, Tone space (Material 3's color space)
+type HCT struct {
+	H float64 // Hue (0-360)
+	C float64 // Chroma (0-100+)
+	T float64 // Tone (0-100)
+}
+
+// cam16 holds the CAM16 appearance correlates of a color.
+type cam16 struct {
+	Hue    float64
+	Chroma float64
+	J      float64 // Lightness
+	Q      float64 // Brightness
+	M      float64 // Colorfulness
+	S      float64 // Saturation
+}
+
+// viewingConditions are the CAM16 parameters derived from the environment a
+// color is viewed in.
+type viewingConditions struct {
+	n      float64
+	aw     float64
+	nbb    float64
+	ncb    float64
+	c      float64
+	nc     float64
+	rgbD   [3]float64
+	fl     float64
+	flRoot float64
+	z      float64
+}
+
+var (
+	whitePointD65 = [3]float64{95.047, 100.0, 108.883}
+
+	srgbToXyz = [3][3]float64{
+		{0.41233895, 0.35762064, 0.18051042},
+		{0.2126, 0.7152, 0.0722},
+		{0.01932141, 0.11916382, 0.95034478},
+	}
+
+	xyzToCam16Rgb = [3][3]float64{
+		{0.401288, 0.650173, -0.051461},
+		{-0.250268, 1.204414, 0.045854},
+		{-0.002079, 0.048952, 0.953127},
+	}
+
+	yFromLinrgb = [3]float64{0.2126, 0.7152, 0.0722}
+)
+
+// defaultViewingConditions matches Material's defaults: a gray-world
+// background at L* 50 under an average surround of 200/pi lux.
+var defaultViewingConditions = newViewingConditions(
+	whitePointD65,
+	200.0/math.Pi*yFromLstar(50.0)/100.0,
+	50.0,
+	2.0,
+	false,
+)
+
+// Matrices used by the HCT solver to move between linear sRGB (0-100) and the
+// chromatically adapted, luminance-scaled cone responses of CAM16.
+var (
+	scaledDiscountFromLinrgb = computeScaledDiscountFromLinrgb(defaultViewingConditions)
+	linrgbFromScaledDiscount = invertMatrix(scaledDiscountFromLinrgb)
+	criticalPlanes           = computeCriticalPlanes()
+)
+
+func newViewingConditions(whitePoint [3]float64, adaptingLuminance, backgroundLstar, surround float64, discountingIlluminant bool) viewingConditions {
+	backgroundLstar = math.Max(0.1, backgroundLstar)
+
+	rgbW := matrixMultiply(whitePoint, xyzToCam16Rgb)
+
+	f := 0.8 + surround/10.0
+	var c float64
+	if f >= 0.9 {
+		c = lerp(0.59, 0.69, (f-0.9)*10.0)
+	} else {
+		c = lerp(0.525, 0.59, (f-0.8)*10.0)
+	}
+
+	d := 1.0
+	if !discountingIlluminant {
+		d = f * (1.0 - (1.0/3.6)*math.Exp((-adaptingLuminance-42.0)/92.0))
+	}
+	d = math.Max(0, math.Min(1, d))
+
+	var rgbD [3]float64
+	for i := range rgbD {
+		rgbD[i] = d*(100.0/rgbW[i]) + 1.0 - d
+	}
+
+	k := 1.0 / (5.0*adaptingLuminance + 1.0)
+	k4 := k * k * k * k
+	k4F := 1.0 - k4
+	fl := k4*adaptingLuminance + 0.1*k4F*k4F*math.Cbrt(5.0*adaptingLuminance)
+
+	n := yFromLstar(backgroundLstar) / whitePoint[1]
+	z := 1.48 + math.Sqrt(n)
+	nbb := 0.725 / math.Pow(n, 0.2)
+
+	var rgbA [3]float64
+	for i := range rgbA {
+		factor := math.Pow(fl*rgbD[i]*rgbW[i]/100.0, 0.42)
+		rgbA[i] = 400.0 * factor / (factor + 27.13)
+	}
+	aw := (2.0*rgbA[0] + rgbA[1] + 0.05*rgbA[2]) * nbb
+
+	return viewingConditions{
+		n:      n,
+		aw:     aw,
+		nbb:    nbb,
+		ncb:    nbb,
+		c:      c,
+		nc:     f,
+		rgbD:   rgbD,
+		fl:     fl,
+		flRoot: math.Pow(fl, 0.25),
+		z:      z,
+	}
+}
+
+// rgbToHct converts RGB to HCT color space (Material 3's perceptual color space)
+func rgbToHct(c color.RGBA) HCT {
+	xyz := rgbToXyz(c)
+	cam := cam16FromXyz(xyz, defaultViewingConditions)
+	return HCT{
+		H: cam.Hue,
+		C: cam.Chroma,
+		T: lstarFromY(xyz[1]),
+	}
+}
+
+// hctToRgb converts HCT back to RGB. When the requested chroma does not exist
+// at that hue and tone, the most chromatic in-gamut color is returned.
+func hctToRgb(hct HCT) color.RGBA {
+	return solveHct(hct.H, hct.C, hct.T)
+}
+
+func rgbToXyz(c color.RGBA) [3]float64 {
+	linrgb := [3]float64{linearized(c.R), linearized(c.G), linearized(c.B)}
+	return matrixMultiply(linrgb, srgbToXyz)
+}
+
+func cam16FromXyz(xyz [3]float64, vc viewingConditions) cam16 {
+	rgbC := matrixMultiply(xyz, xyzToCam16Rgb)
+
+	var rgbA [3]float64
+	for i := range rgbA {
+		rD := vc.rgbD[i] * rgbC[i]
+		af := math.Pow(vc.fl*math.Abs(rD)/100.0, 0.42)
+		rgbA[i] = signum(rD) * 400.0 * af / (af + 27.13)
+	}
+	rA, gA, bA := rgbA[0], rgbA[1], rgbA[2]
+
+	// Redness-greenness and yellowness-blueness opponent dimensions.
+	a := (11.0*rA + -12.0*gA + bA) / 11.0
+	b := (rA + gA - 2.0*bA) / 9.0
+
+	u := (20.0*rA + 20.0*gA + 21.0*bA) / 20.0
+	p2 := (40.0*rA + 20.0*gA + bA) / 20.0
+
+	hue := sanitizeDegrees(math.Atan2(b, a) * 180.0 / math.Pi)
+
+	ac := p2 * vc.nbb
+	j := 100.0 * math.Pow(ac/vc.aw, vc.c*vc.z)
+	q := 4.0 / vc.c * math.Sqrt(j/100.0) * (vc.aw + 4.0) * vc.flRoot
+
+	huePrime := hue
+	if hue < 20.14 {
+		huePrime = hue + 360
+	}
+	eHue := 0.25 * (math.Cos(huePrime*math.Pi/180.0+2.0) + 3.8)
+	p1 := 50000.0 / 13.0 * eHue * vc.nc * vc.ncb
+	t := p1 * math.Hypot(a, b) / (u + 0.305)
+	alpha := math.Pow(t, 0.9) * math.Pow(1.64-math.Pow(0.29, vc.n), 0.73)
+
+	chroma := alpha * math.Sqrt(j/100.0)
+	m := chroma * vc.flRoot
+	s := 50.0 * math.Sqrt(alpha*vc.c/(vc.aw+4.0))
+
+	return cam16{Hue: hue, Chroma: chroma, J: j, Q: q, M: m, S: s}
+}
+
+// solveHct finds the sRGB color with the given hue and tone whose chroma is
+// closest to the requested chroma, reducing chroma at constant hue and tone
+// when the request lies outside the gamut.
+func solveHct(hue, chroma, tone float64) color.RGBA {
+	if chroma < 0.0001 || tone < 0.0001 || tone > 99.9999 {
+		return rgbFromLstar(tone)
+	}
+
+	hueRadians := sanitizeDegrees(hue) * math.Pi / 180.0
+	y := yFromLstar(tone)
+
+	if exact, ok := findResultByJ(hueRadians, chroma, y); ok {
+		return exact
+	}
+	return rgbFromLinrgb(bisectToLimit(y, hueRadians))
+}
+
+// findResultByJ solves for the CAM16 J that produces luminance y at the given
+// hue and chroma using Newton's method. It fails when the result is out of
+// gamut.
+func findResultByJ(hueRadians, chroma, y float64) (color.RGBA, bool) {
+	vc := defaultViewingConditions
+
+	j := math.Sqrt(y) * 11.0
+	tInnerCoeff := 1.0 / math.Pow(1.64-math.Pow(0.29, vc.n), 0.73)
+	eHue := 0.25 * (math.Cos(hueRadians+2.0) + 3.8)
+	p1 := eHue * (50000.0 / 13.0) * vc.nc * vc.ncb
+	hSin, hCos := math.Sin(hueRadians), math.Cos(hueRadians)
+
+	for iteration := 0; iteration < 5; iteration++ {
+		jNormalized := j / 100.0
+		alpha := 0.0
+		if chroma != 0 && j != 0 {
+			alpha = chroma / math.Sqrt(jNormalized)
+		}
+		t := math.Pow(alpha*tInnerCoeff, 1.0/0.9)
+		ac := vc.aw * math.Pow(jNormalized, 1.0/vc.c/vc.z)
+		p2 := ac / vc.nbb
+		gamma := 23.0 * (p2 + 0.305) * t / (23.0*p1 + 11*t*hCos + 108.0*t*hSin)
+		a := gamma * hCos
+		b := gamma * hSin
+
+		rgbScaled := [3]float64{
+			inverseChromaticAdaptation((460.0*p2 + 451.0*a + 288.0*b) / 1403.0),
+			inverseChromaticAdaptation((460.0*p2 - 891.0*a - 261.0*b) / 1403.0),
+			inverseChromaticAdaptation((460.0*p2 - 220.0*a - 6300.0*b) / 1403.0),
+		}
+		linrgb := matrixMultiply(rgbScaled, linrgbFromScaledDiscount)
+		if linrgb[0] < 0 || linrgb[1] < 0 || linrgb[2] < 0 {
+			return color.RGBA{}, false
+		}
+
+		fnj := yFromLinrgb[0]*linrgb[0] + yFromLinrgb[1]*linrgb[1] + yFromLinrgb[2]*linrgb[2]
+		if fnj <= 0 {
+			return color.RGBA{}, false
+		}
+		if iteration == 4 || math.Abs(fnj-y) < 0.002 {
+			if linrgb[0] > 100.01 || linrgb[1] > 100.01 || linrgb[2] > 100.01 {
+				return color.RGBA{}, false
+			}
+			return rgbFromLinrgb(linrgb), true
+		}
+
+		// Newton step, using 2 * fn(j) / j as the approximation of fn'(j).
+		j = j - (fnj-y)*j/(2*fnj)
+	}
+	return color.RGBA{}, false
+}
+
+// bisectToLimit finds the most chromatic in-gamut color of luminance y and
+// the given hue by walking the edge of the RGB cube's constant-y slice.
+func bisectToLimit(y, targetHue float64) [3]float64 {
+	left, right := bisectToSegment(y, targetHue)
+	leftHue := hueOfLinrgb(left)
+
+	for axis := 0; axis < 3; axis++ {
+		if left[axis] == right[axis] {
+			continue
+		}
+
+		var lPlane, rPlane int
+		if left[axis] < right[axis] {
+			lPlane = criticalPlaneBelow(trueDelinearized(left[axis]))
+			rPlane = criticalPlaneAbove(trueDelinearized(right[axis]))
+		} else {
+			lPlane = criticalPlaneAbove(trueDelinearized(left[axis]))
+			rPlane = criticalPlaneBelow(trueDelinearized(right[axis]))
+		}
+
+		for i := 0; i < 8; i++ {
+			if absInt(rPlane-lPlane) <= 1 {
+				break
+			}
+			mPlane := (lPlane + rPlane) / 2
+			mid := setCoordinate(left, criticalPlanes[mPlane], right, axis)
+			midHue := hueOfLinrgb(mid)
+			if areInCyclicOrder(leftHue, targetHue, midHue) {
+				right = mid
+				rPlane = mPlane
+			} else {
+				left = mid
+				leftHue = midHue
+				lPlane = mPlane
+			}
+		}
+	}
+
+	return [3]float64{
+		(left[0] + right[0]) / 2,
+		(left[1] + right[1]) / 2,
+		(left[2] + right[2]) / 2,
+	}
+}
+
+// bisectToSegment finds the two vertices of the constant-y slice of the RGB
+// cube whose hues enclose targetHue.
+func bisectToSegment(y, targetHue float64) ([3]float64, [3]float64) {
+	var left, right [3]float64
+	var leftHue, rightHue float64
+	initialized := false
+	uncut := true
+
+	for n := 0; n < 12; n++ {
+		mid, ok := nthVertex(y, n)
+		if !ok {
+			continue
+		}
+		midHue := hueOfLinrgb(mid)
+		if !initialized {
+			left, right = mid, mid
+			leftHue, rightHue = midHue, midHue
+			initialized = true
+			continue
+		}
+		if uncut || areInCyclicOrder(leftHue, midHue, rightHue) {
+			uncut = false
+			if areInCyclicOrder(leftHue, targetHue, midHue) {
+				right = mid
+				rightHue = midHue
+			} else {
+				left = mid
+				leftHue = midHue
+			}
+		}
+	}
+	return left, right
+}
+
+// nthVertex returns the nth possible vertex of the polygon formed by
+// intersecting the RGB cube with the plane of luminance y.
+func nthVertex(y float64, n int) ([3]float64, bool) {
+	kR, kG, kB := yFromLinrgb[0], yFromLinrgb[1], yFromLinrgb[2]
+	coordA := 100.0
+	if n%4 <= 1 {
+		coordA = 0.0
+	}
+	coordB := 100.0
+	if n%2 == 0 {
+		coordB = 0.0
+	}
+
+	var vertex [3]float64
+	switch {
+	case n < 4:
+		g, b := coordA, coordB
+		vertex = [3]float64{(y - g*kG - b*kB) / kR, g, b}
+		return vertex, isBounded(vertex[0])
+	case n < 8:
+		b, r := coordA, coordB
+		vertex = [3]float64{r, (y - r*kR - b*kB) / kG, b}
+		return vertex, isBounded(vertex[1])
+	default:
+		r, g := coordA, coordB
+		vertex = [3]float64{r, g, (y - r*kR - g*kG) / kB}
+		return vertex, isBounded(vertex[2])
+	}
+}
+
+// hueOfLinrgb returns the CAM16 hue, in radians, of a linear RGB color.
+func hueOfLinrgb(linrgb [3]float64) float64 {
+	scaled := matrixMultiply(linrgb, scaledDiscountFromLinrgb)
+	rA := chromaticAdaptation(scaled[0])
+	gA := chromaticAdaptation(scaled[1])
+	bA := chromaticAdaptation(scaled[2])
+	a := (11.0*rA + -12.0*gA + bA) / 11.0
+	b := (rA + gA - 2.0*bA) / 9.0
+	return math.Atan2(b, a)
+}
+
+func chromaticAdaptation(component float64) float64 {
+	af := math.Pow(math.Abs(component), 0.42)
+	return signum(component) * 400.0 * af / (af + 27.13)
+}
+
+func inverseChromaticAdaptation(adapted float64) float64 {
+	adaptedAbs := math.Abs(adapted)
+	base := math.Max(0, 27.13*adaptedAbs/(400.0-adaptedAbs))
+	return signum(adapted) * math.Pow(base, 1.0/0.42)
+}
+
+func computeScaledDiscountFromLinrgb(vc viewingConditions) [3][3]float64 {
+	var m [3][3]float64
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			sum := 0.0
+			for k := 0; k < 3; k++ {
+				sum += xyzToCam16Rgb[row][k] * srgbToXyz[k][col]
+			}
+			m[row][col] = sum * vc.rgbD[row] * vc.fl / 100.0
+		}
+	}
+	return m
+}
+
+// computeCriticalPlanes returns the linear RGB values (0-100) halfway between
+// consecutive 8-bit sRGB levels.
+func computeCriticalPlanes() [255]float64 {
+	var planes [255]float64
+	for i := range planes {
+		normalized := (float64(i) + 0.5) / 255.0
+		if normalized <= 0.040449936 {
+			planes[i] = normalized / 12.92 * 100.0
+		} else {
+			planes[i] = math.Pow((normalized+0.055)/1.055, 2.4) * 100.0
+		}
+	}
+	return planes
+}
+
+func areInCyclicOrder(a, b, c float64) bool {
+	return sanitizeRadians(b-a) < sanitizeRadians(c-a)
+}
+
+func setCoordinate(source [3]float64, coordinate float64, target [3]float64, axis int) [3]float64 {
+	t := (coordinate - source[axis]) / (target[axis] - source[axis])
+	return [3]float64{
+		source[0] + (target[0]-source[0])*t,
+		source[1] + (target[1]-source[1])*t,
+		source[2] + (target[2]-source[2])*t,
+	}
+}
+
+func isBounded(x float64) bool { return x >= 0 && x <= 100 }
+
+func criticalPlaneBelow(x float64) int { return int(math.Floor(x - 0.5)) }
+
+func criticalPlaneAbove(x float64) int { return int(math.Ceil(x - 0.5)) }
+
+// trueDelinearized converts a linear component (0-100) to unrounded sRGB (0-255).
+func trueDelinearized(component float64) float64 {
+	normalized := component / 100.0
+	if normalized <= 0.0031308 {
+		return normalized * 12.92 * 255.0
+	}
+	return (1.055*math.Pow(normalized, 1.0/2.4) - 0.055) * 255.0
+}
+
+// linearized converts an sRGB component to linear RGB (0-100).
+func linearized(component uint8) float64 {
+	normalized := float64(component) / 255.0
+	if normalized <= 0.040449936 {
+		return normalized / 12.92 * 100.0
+	}
+	return math.Pow((normalized+0.055)/1.055, 2.4) * 100.0
+}
+
+// delinearized converts a linear component (0-100) to an 8-bit sRGB value.
+func delinearized(component float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(trueDelinearized(component)))))
+}
+
+func rgbFromLinrgb(linrgb [3]float64) color.RGBA {
+	return color.RGBA{
+		R: delinearized(linrgb[0]),
+		G: delinearized(linrgb[1]),
+		B: delinearized(linrgb[2]),
+		A: 255,
+	}
+}
+
+// rgbFromLstar returns the gray with the given L*.
+func rgbFromLstar(lstar float64) color.RGBA {
+	component := delinearized(yFromLstar(lstar))
+	return color.RGBA{R: component, G: component, B: component, A: 255}
+}
+
+// yFromLstar converts L* to relative luminance Y (0-100).
+func yFromLstar(lstar float64) float64 {
+	return 100.0 * labInvf((lstar+16.0)/116.0)
+}
+
+// lstarFromY converts relative luminance Y (0-100) to L*.
+func lstarFromY(y float64) float64 {
+	return labF(y/100.0)*116.0 - 16.0
+}
+
+func labF(t float64) float64 {
+	const e = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+	if t > e {
+		return math.Cbrt(t)
+	}
+	return (kappa*t + 16.0) / 116.0
+}
+
+func labInvf(ft float64) float64 {
+	const e = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+	ft3 := ft * ft * ft
+	if ft3 > e {
+		return ft3
+	}
+	return (116.0*ft - 16.0) / kappa
+}
+
+func matrixMultiply(row [3]float64, matrix [3][3]float64) [3]float64 {
+	return [3]float64{
+		row[0]*matrix[0][0] + row[1]*matrix[0][1] + row[2]*matrix[0][2],
+		row[0]*matrix[1][0] + row[1]*matrix[1][1] + row[2]*matrix[1][2],
+		row[0]*matrix[2][0] + row[1]*matrix[2][1] + row[2]*matrix[2][2],
+	}
+}
+
+func invertMatrix(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+
+	return [3][3]float64{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
+
+func sanitizeDegrees(degrees float64) float64 {
+	degrees = math.Mod(degrees, 360.0)
+	if degrees < 0 {
+		degrees += 360.0
+	}
+	return degrees
+}
+
+func sanitizeRadians(angle float64) float64 {
+	return math.Mod(angle+math.Pi*8, math.Pi*2)
+}
+
+func signum(x float64) float64 {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func lerp(start, stop, amount float64) float64 {
+	return (1.0-amount)*start + amount*stop
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyDir holds past theme files, named by the hash of their content.
+var historyDir = filepath.Join(tm0dDir, "history")
+
+const (
+	// maxHistoryEntries is how many unpinned themes are kept; pinned ones
+	// never count against it.
+	maxHistoryEntries = 30
+	historyIDLength   = 12
+)
+
+// historyEntry is a theme in the history index.
+type historyEntry struct {
+	ID     string    `json:"id"`
+	Saved  time.Time `json:"saved"` // Last time this theme was generated or applied
+	Pinned bool      `json:"pinned,omitempty"`
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "history - list, inspect and restore previously generated themes",
+}
+
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list saved themes, newest first",
+	Args:  cobra.NoArgs,
+	Run:   ListHistory,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "show the wallpapers and colors of a saved theme",
+	Args:  cobra.ExactArgs(1),
+	Run:   ShowHistory,
+}
+
+var historyApplyCmd = &cobra.Command{
+	Use:   "apply <id>",
+	Short: "make a saved theme current and build it",
+	Args:  cobra.ExactArgs(1),
+	Run:   ApplyHistory,
+}
+
+var historyPinCmd = &cobra.Command{
+	Use:   "pin <id>",
+	Short: "keep a saved theme forever",
+	Args:  cobra.ExactArgs(1),
+	Run:   func(cmd *cobra.Command, args []string) { setHistoryPin(args[0], true) },
+}
+
+var historyUnpinCmd = &cobra.Command{
+	Use:   "unpin <id>",
+	Short: "let a saved theme be pruned again",
+	Args:  cobra.ExactArgs(1),
+	Run:   func(cmd *cobra.Command, args []string) { setHistoryPin(args[0], false) },
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyListCmd, historyShowCmd, historyApplyCmd, historyPinCmd, historyUnpinCmd)
+	addBuildFlags(historyApplyCmd)
+}
+
+// themeID is the content address of a theme: a hash of its settings and
+// monitors, so generating the same theme twice gives the same id.
+func themeID(file ThemeFile) (string, error) {
+	content, err := json.Marshal(struct {
+		Settings GenerateSettings
+		Monitors []MonitorInfo
+	}{file.Settings, file.Monitors})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:historyIDLength], nil
+}
+
+func historyPath(name string) string {
+	return filepath.Join(homeDir, historyDir, name)
+}
+
+// loadHistory reads the history index, newest first. A missing index is
+// an empty history.
+func loadHistory() ([]historyEntry, error) {
+	data, err := os.ReadFile(historyPath("index.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse history index: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Saved.After(entries[j].Saved)
+	})
+	return entries, nil
+}
+
+// saveHistory prunes the oldest unpinned entries beyond the limit, deletes
+// their theme files and writes the index.
+func saveHistory(entries []historyEntry) error {
+	var kept []historyEntry
+	unpinned := 0
+	for _, entry := range entries {
+		if !entry.Pinned {
+			unpinned++
+			if unpinned > maxHistoryEntries {
+				_ = os.Remove(historyPath(entry.ID + ".tm0d"))
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to generate history JSON: %w", err)
+	}
+	if err := os.WriteFile(historyPath("index.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write history index: %w", err)
+	}
+	return nil
+}
+
+// recordHistory stores a theme file under its id and moves it to the top
+// of the history, and returns the id.
+func recordHistory(file ThemeFile, data []byte) (string, error) {
+	id, err := themeID(file)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(historyPath(""), 0755); err != nil {
+		return "", fmt.Errorf("could not create history directory: %w", err)
+	}
+	if err := os.WriteFile(historyPath(id+".tm0d"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write history entry: %w", err)
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		return "", err
+	}
+	entry := historyEntry{ID: id}
+	for i, e := range entries {
+		if e.ID == id {
+			entry = e
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	entry.Saved = time.Now().UTC().Truncate(time.Second)
+	return id, saveHistory(append([]historyEntry{entry}, entries...))
+}
+
+// findHistoryEntry resolves an id or an unambiguous prefix of one.
+func findHistoryEntry(entries []historyEntry, id string) (int, error) {
+	if id == "" {
+		return -1, fmt.Errorf("no theme %q in the history, see 'history list'", id)
+	}
+	found := -1
+	for i, entry := range entries {
+		if !strings.HasPrefix(entry.ID, id) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("%q matches more than one theme", id)
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("no theme %q in the history, see 'history list'", id)
+	}
+	return found, nil
+}
+
+// wallpaperSummary names the wallpaper of every monitor in a theme.
+func wallpaperSummary(file ThemeFile) string {
+	parts := make([]string, 0, len(file.Monitors))
+	for _, m := range file.Monitors {
+		parts = append(parts, m.Monitor+": "+filepath.Base(m.Theme.WallpaperPath))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func ListHistory(cmd *cobra.Command, args []string) {
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No themes in the history yet. Run 'generate' to create one.")
+		return
+	}
+
+	current := ""
+	if file, err := readThemeFile(filepath.Join(homeDir, themeFileDir)); err == nil {
+		current, _ = themeID(file)
+	}
+
+	for _, entry := range entries {
+		marker := " "
+		if entry.ID == current {
+			marker = "*"
+		}
+		pin := "      "
+		if entry.Pinned {
+			pin = "pinned"
+		}
+
+		summary := "(theme file missing)"
+		if file, err := readThemeFile(historyPath(entry.ID + ".tm0d")); err == nil {
+			summary = wallpaperSummary(file)
+		}
+		fmt.Printf("%s %s  %s  %s  %s\n", marker, entry.ID, entry.Saved.Local().Format("2006-01-02 15:04"), pin, summary)
+	}
+}
+
+func ShowHistory(cmd *cobra.Command, args []string) {
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	i, err := findHistoryEntry(entries, args[0])
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	entry := entries[i]
+	file, err := readThemeFile(historyPath(entry.ID + ".tm0d"))
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Theme %s\n", entry.ID)
+	fmt.Printf("  Generated: %s by archThemeM0d %s\n", file.Generated.Local().Format(time.DateTime), file.Generator)
+	fmt.Printf("  Settings:  source %s, quantizer %s, %d colors, pixel budget %d\n",
+		file.Settings.Source, file.Settings.Quantizer, file.Settings.Colors, file.Settings.PixelBudget)
+	fmt.Printf("  Pinned:    %t\n", entry.Pinned)
+	for _, m := range file.Monitors {
+		fmt.Printf("\n  %s: %s\n", m.Monitor, m.Theme.WallpaperPath)
+		if m.Theme.Seed != "" {
+			fmt.Printf("    seed %s\n", m.Theme.Seed)
+		}
+		for _, s := range m.Theme.colorSwatches() {
+			fmt.Printf("    #%02x%02x%02x  %5.1f%%\n", s.Color.R, s.Color.G, s.Color.B, s.Proportion*100)
+		}
+	}
+}
+
+// ApplyHistory makes a saved theme current and builds the templates
+// with it, as if it had just been generated.
+func ApplyHistory(cmd *cobra.Command, args []string) {
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	i, err := findHistoryEntry(entries, args[0])
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	entry := entries[i]
+	data, err := os.ReadFile(historyPath(entry.ID + ".tm0d"))
+	if err != nil {
+		fmt.Printf("ERROR: Could not read saved theme: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, themeFileDir), data, 0644); err != nil {
+		fmt.Printf("ERROR: Could not restore theme file: %v\n", err)
+		return
+	}
+
+	entry.Saved = time.Now().UTC().Truncate(time.Second)
+	entries = append(entries[:i], entries[i+1:]...)
+	if err := saveHistory(append([]historyEntry{entry}, entries...)); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	}
+
+	fmt.Printf("Restored theme %s\n", entry.ID)
+	BuildTemplates(cmd, args)
+}
+
+func setHistoryPin(id string, pinned bool) {
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	i, err := findHistoryEntry(entries, id)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	entries[i].Pinned = pinned
+	if err := saveHistory(entries); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if pinned {
+		fmt.Printf("Pinned theme %s\n", entries[i].ID)
+	} else {
+		fmt.Printf("Unpinned theme %s\n", entries[i].ID)
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// hyprIPCTimeout bounds a single request/response round trip.
+const hyprIPCTimeout = 2 * time.Second
+
+// HyprMonitor is a monitor as reported by Hyprland's "j/monitors" request.
+type HyprMonitor struct {
+	ID              int     `json:"id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description"`
+	Width           int     `json:"width"`
+	Height          int     `json:"height"`
+	RefreshRate     float64 `json:"refreshRate"`
+	X               int     `json:"x"`
+	Y               int     `json:"y"`
+	Scale           float64 `json:"scale"`
+	Focused         bool    `json:"focused"`
+	Disabled        bool    `json:"disabled"`
+	ActiveWorkspace struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"activeWorkspace"`
+}
+
+// HyprWallpaper is one entry of hyprpaper's "listactive" response.
+type HyprWallpaper struct {
+	Monitor string
+	Path    string
+}
+
+// HyprEvent is one "EVENT>>DATA" line from Hyprland's event socket.
+type HyprEvent struct {
+	Name string
+	Data string
+}
+
+// HyprlandClient talks to Hyprland's request socket (.socket.sock) and
+// event socket (.socket2.sock).
+type HyprlandClient struct {
+	SocketPath      string
+	EventSocketPath string
+}
+
+// HyprpaperClient talks to hyprpaper's request socket (.hyprpaper.sock).
+type HyprpaperClient struct {
+	SocketPath string
+}
+
+// hyprInstanceDir returns the runtime directory of the running Hyprland
+// instance. Hyprland < 0.40 kept its sockets under /tmp/hypr instead.
+func hyprInstanceDir() (string, error) {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature == "" {
+		return "", fmt.Errorf("This only works with arch hyprland")
+	}
+
+	candidates := []string{filepath.Join("/tmp/hypr", signature)}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append([]string{filepath.Join(runtimeDir, "hypr", signature)}, candidates...)
+	}
+
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("could not find Hyprland runtime directory (tried %s)", strings.Join(candidates, ", "))
+}
+
+// NewHyprlandClient returns a client for the current Hyprland instance.
+func NewHyprlandClient() (*HyprlandClient, error) {
+	dir, err := hyprInstanceDir()
+	if err != nil {
+		return nil, err
+	}
+	return &HyprlandClient{
+		SocketPath:      filepath.Join(dir, ".socket.sock"),
+		EventSocketPath: filepath.Join(dir, ".socket2.sock"),
+	}, nil
+}
+
+// NewHyprpaperClient returns a client for the hyprpaper instance running
+// under the current Hyprland session.
+func NewHyprpaperClient() (*HyprpaperClient, error) {
+	dir, err := hyprInstanceDir()
+	if err != nil {
+		return nil, err
+	}
+	return &HyprpaperClient{SocketPath: filepath.Join(dir, ".hyprpaper.sock")}, nil
+}
+
+// hyprRequest sends one command over a Unix socket and returns everything the
+// server writes back before closing the connection.
+func hyprRequest(socketPath, command string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socketPath, hyprIPCTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(hyprIPCTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return nil, fmt.Errorf("could not send %q: %w", command, err)
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response to %q: %w", command, err)
+	}
+	if strings.TrimSpace(string(response)) == "unknown request" {
+		return nil, fmt.Errorf("request %q was rejected: unknown request", command)
+	}
+	return response, nil
+}
+
+// Request sends a raw command such as "j/monitors" to Hyprland.
+func (c *HyprlandClient) Request(command string) ([]byte, error) {
+	return hyprRequest(c.SocketPath, command)
+}
+
+// Monitors returns all monitors known to Hyprland.
+func (c *HyprlandClient) Monitors() ([]HyprMonitor, error) {
+	response, err := c.Request("j/monitors")
+	if err != nil {
+		return nil, err
+	}
+
+	var monitors []HyprMonitor
+	if err := json.Unmarshal(response, &monitors); err != nil {
+		return nil, fmt.Errorf("could not decode monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// Events subscribes to Hyprland's event stream. The returned channel is
+// closed when ctx is cancelled or Hyprland closes the connection.
+func (c *HyprlandClient) Events(ctx context.Context) (<-chan HyprEvent, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.EventSocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", c.EventSocketPath, err)
+	}
+
+	events := make(chan HyprEvent)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(events)
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			name, data, ok := strings.Cut(scanner.Text(), ">>")
+			if !ok {
+				continue
+			}
+			select {
+			case events <- HyprEvent{Name: name, Data: data}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Request sends a raw command such as "listactive" to hyprpaper.
+func (c *HyprpaperClient) Request(command string) ([]byte, error) {
+	return hyprRequest(c.SocketPath, command)
+}
+
+// ActiveWallpapers returns the wallpaper hyprpaper is showing on each monitor.
+// A wallpaper applied to every monitor is reported with an empty Monitor.
+func (c *HyprpaperClient) ActiveWallpapers() ([]HyprWallpaper, error) {
+	response, err := c.Request("listactive")
+	if err != nil {
+		return nil, err
+	}
+
+	var wallpapers []HyprWallpaper
+	for _, line := range strings.Split(string(response), "\n") {
+		monitor, path, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		wallpapers = append(wallpapers, HyprWallpaper{
+			Monitor: strings.TrimSpace(monitor),
+			Path:    path,
+		})
+	}
+	return wallpapers, nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeHyprSocket serves Hyprland-style requests on a Unix socket in a
+// temporary directory: every connection sends one command and gets the
+// matching response, or "unknown request", before the server closes it.
+func fakeHyprSocket(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".socket.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", path, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				response, ok := responses[string(buf[:n])]
+				if !ok {
+					response = "unknown request"
+				}
+				conn.Write([]byte(response))
+			}()
+		}
+	}()
+	return path
+}
+
+func TestHyprlandMonitors(t *testing.T) {
+	socket := fakeHyprSocket(t, map[string]string{
+		"j/monitors": `[
+			{"id": 0, "name": "DP-1", "description": "Dell U2720Q", "width": 3840, "height": 2160,
+			 "refreshRate": 59.997, "x": 0, "y": 0, "scale": 1.5, "focused": true,
+			 "activeWorkspace": {"id": 1, "name": "1"}},
+			{"id": 1, "name": "HDMI-A-1", "width": 1920, "height": 1080, "x": 2560, "y": 0,
+			 "scale": 1, "disabled": true, "activeWorkspace": {"id": 2, "name": "web"}}
+		]`,
+	})
+	client := &HyprlandClient{SocketPath: socket}
+
+	monitors, err := client.Monitors()
+	if err != nil {
+		t.Fatalf("Monitors: %v", err)
+	}
+	if len(monitors) != 2 {
+		t.Fatalf("got %d monitors, want 2", len(monitors))
+	}
+
+	first := monitors[0]
+	if first.Name != "DP-1" || first.Description != "Dell U2720Q" || first.Width != 3840 || first.Height != 2160 ||
+		first.Scale != 1.5 || !first.Focused || first.ActiveWorkspace.ID != 1 {
+		t.Errorf("first monitor decoded as %+v", first)
+	}
+	second := monitors[1]
+	if second.Name != "HDMI-A-1" || second.X != 2560 || !second.Disabled || second.ActiveWorkspace.Name != "web" {
+		t.Errorf("second monitor decoded as %+v", second)
+	}
+}
+
+func TestHyprpaperActiveWallpapers(t *testing.T) {
+	socket := fakeHyprSocket(t, map[string]string{
+		"listactive": "DP-1 = /home/user/Pictures/forest.png\n" +
+			"HDMI-A-1 = /home/user/Pictures/sea.jpg\n" +
+			" = /home/user/Pictures/everywhere.png\n" +
+			"eDP-1 = \n" +
+			"no active wallpapers\n",
+	})
+	client := &HyprpaperClient{SocketPath: socket}
+
+	wallpapers, err := client.ActiveWallpapers()
+	if err != nil {
+		t.Fatalf("ActiveWallpapers: %v", err)
+	}
+	want := []HyprWallpaper{
+		{Monitor: "DP-1", Path: "/home/user/Pictures/forest.png"},
+		{Monitor: "HDMI-A-1", Path: "/home/user/Pictures/sea.jpg"},
+		{Monitor: "", Path: "/home/user/Pictures/everywhere.png"},
+	}
+	if !reflect.DeepEqual(wallpapers, want) {
+		t.Errorf("got %+v, want %+v", wallpapers, want)
+	}
+}
+
+func TestHyprRequestUnknown(t *testing.T) {
+	socket := fakeHyprSocket(t, nil)
+	client := &HyprlandClient{SocketPath: socket}
+
+	_, err := client.Request("j/nonsense")
+	if err == nil {
+		t.Fatal("expected an error for an unknown request")
+	}
+	if !strings.Contains(err.Error(), "unknown request") || !strings.Contains(err.Error(), "j/nonsense") {
+		t.Errorf("error %q does not name the rejected request", err)
+	}
+
+	if _, err := client.Monitors(); err == nil {
+		t.Error("Monitors did not fail on an unknown request")
+	}
+}
+
+func TestHyprlandEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".socket2.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", path, err)
+	}
+	defer listener.Close()
+
+	// The server sends a few events and then keeps the connection open,
+	// like Hyprland does, until the client goes away.
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("workspace>>2\nnot an event\nactivewindow>>kitty,~>>vim\nmonitoradded>>HDMI-A-1\n"))
+		buf := make([]byte, 64)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &HyprlandClient{EventSocketPath: path}
+	events, err := client.Events(ctx)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+
+	want := []HyprEvent{
+		{Name: "workspace", Data: "2"},
+		{Name: "activewindow", Data: "kitty,~>>vim"},
+		{Name: "monitoradded", Data: "HDMI-A-1"},
+	}
+	for _, w := range want {
+		select {
+		case got, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed before %+v", w)
+			}
+			if got != w {
+				t.Errorf("got event %+v, want %+v", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %+v", w)
+		}
+	}
+
+	cancel()
+	select {
+	case got, ok := <-events:
+		if ok {
+			t.Errorf("got event %+v after cancelling", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("events were not closed after cancelling")
+	}
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Error("connection was not closed after cancelling")
+	}
+}
@@ -0,0 +1,752 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/cascax/colorthief-go"
+)
+
+// quantizer reduces an image to its most representative colors, ordered
+// from most to least important. Only Color and Population of the returned
+// swatches are set.
+type quantizer struct {
+	Name        string
+	Description string
+	quantize    func(img image.Image, count int) ([]Swatch, error)
+}
+
+const defaultQuantizer = "mmcq"
+
+var quantizers = []quantizer{
+	{
+		Name:        "mmcq",
+		Description: "modified median cut (colorthief), favors large areas",
+		quantize:    quantizeMmcq,
+	},
+	{
+		Name:        "wu",
+		Description: "Wu's variance-minimizing box cuts in RGB",
+		quantize: func(img image.Image, count int) ([]Swatch, error) {
+			return byPopulation(quantizeWu(quantizePixels(img), count)), nil
+		},
+	},
+	{
+		Name:        "kmeans",
+		Description: "weighted k-means in CIE Lab, a perceptual space",
+		quantize: func(img image.Image, count int) ([]Swatch, error) {
+			return byPopulation(quantizeWsmeans(quantizePixels(img), nil, count)), nil
+		},
+	},
+	{
+		Name:        "celebi",
+		Description: "Material's quantizer: Wu refined by k-means, ranked by score",
+		quantize:    quantizeCelebi,
+	},
+}
+
+// findQuantizer looks up a quantizer by name.
+func findQuantizer(name string) (quantizer, error) {
+	for _, q := range quantizers {
+		if q.Name == name {
+			return q, nil
+		}
+	}
+	return quantizer{}, fmt.Errorf("unknown quantizer %q (valid: %s)", name, strings.Join(quantizerNames(), ", "))
+}
+
+func quantizerNames() []string {
+	names := make([]string, 0, len(quantizers))
+	for _, q := range quantizers {
+		names = append(names, q.Name)
+	}
+	return names
+}
+
+// quantizePixels returns the opaque pixels of img. Images are downscaled to
+// the pixel budget before they reach the quantizers, so populations count
+// pixels of the downscaled image.
+func quantizePixels(img image.Image) []color.RGBA {
+	bounds := img.Bounds()
+	pixels := make([]color.RGBA, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			pixels = append(pixels, color.RGBA{R: c.R, G: c.G, B: c.B, A: 255})
+		}
+	}
+	return pixels
+}
+
+// byPopulation orders quantized colors from most to least common.
+func byPopulation(populations map[color.RGBA]int) []Swatch {
+	swatches := make([]Swatch, 0, len(populations))
+	for c, population := range populations {
+		swatches = append(swatches, Swatch{Color: c, Population: population})
+	}
+	sort.Slice(swatches, func(i, j int) bool {
+		if swatches[i].Population != swatches[j].Population {
+			return swatches[i].Population > swatches[j].Population
+		}
+		return rgbKey(swatches[i].Color) < rgbKey(swatches[j].Color)
+	})
+	return swatches
+}
+
+func swatchColors(swatches []Swatch) []color.RGBA {
+	colors := make([]color.RGBA, len(swatches))
+	for i, s := range swatches {
+		colors[i] = s.Color
+	}
+	return colors
+}
+
+func rgbKey(c color.RGBA) int {
+	return int(c.R)<<16 | int(c.G)<<8 | int(c.B)
+}
+
+// quantizeMmcq keeps colorthief's order. Median cut doesn't report
+// populations, so every sampled pixel is counted toward its nearest color.
+func quantizeMmcq(img image.Image, count int) ([]Swatch, error) {
+	palette, err := colorthief.GetPalette(img, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var swatches []Swatch
+	for _, c := range palette {
+		// Flat images come back padded with transparent black, which is
+		// not a wallpaper color.
+		if rgba, ok := c.(color.RGBA); ok && rgba.A != 0 {
+			swatches = append(swatches, Swatch{Color: rgba})
+		}
+	}
+	if len(swatches) == 0 {
+		return swatches, nil
+	}
+
+	for _, p := range quantizePixels(img) {
+		nearest, nearestDistance := 0, math.MaxInt
+		for i, s := range swatches {
+			dr, dg, db := int(p.R)-int(s.Color.R), int(p.G)-int(s.Color.G), int(p.B)-int(s.Color.B)
+			if d := dr*dr + dg*dg + db*db; d < nearestDistance {
+				nearest, nearestDistance = i, d
+			}
+		}
+		swatches[nearest].Population++
+	}
+	return swatches, nil
+}
+
+// quantizeCelebi runs Wu to find starting clusters, refines them with
+// weighted k-means and ranks the result like Material's Score: colorful,
+// well represented and mutually distinct hues first, the rest by
+// population.
+func quantizeCelebi(img image.Image, count int) ([]Swatch, error) {
+	pixels := quantizePixels(img)
+	clusters := swatchColors(byPopulation(quantizeWu(pixels, 128)))
+	populations := quantizeWsmeans(pixels, clusters, 128)
+
+	var ranked []Swatch
+	chosen := make(map[color.RGBA]bool)
+	for _, c := range scoreColors(populations, count) {
+		ranked = append(ranked, Swatch{Color: c, Population: populations[c]})
+		chosen[c] = true
+	}
+	for _, s := range byPopulation(populations) {
+		if len(ranked) >= count {
+			break
+		}
+		if !chosen[s.Color] {
+			ranked = append(ranked, s)
+		}
+	}
+	return ranked, nil
+}
+
+// Wu's color quantizer, ported from Material Color Utilities. Colors are
+// binned into a 32x32x32 histogram with cumulative moments, then the box
+// with the largest variance is cut in two until count boxes exist.
+
+const (
+	wuIndexBits  = 5
+	wuSideLength = 33
+	wuTotalSize  = wuSideLength * wuSideLength * wuSideLength
+)
+
+type wuBox struct {
+	r0, r1, g0, g1, b0, b1 int
+	vol                    int
+}
+
+type wuQuantizer struct {
+	weights, momentsR, momentsG, momentsB, moments []float64
+}
+
+func wuIndex(r, g, b int) int {
+	return r*wuSideLength*wuSideLength + g*wuSideLength + b
+}
+
+func quantizeWu(pixels []color.RGBA, count int) map[color.RGBA]int {
+	q := wuQuantizer{
+		weights:  make([]float64, wuTotalSize),
+		momentsR: make([]float64, wuTotalSize),
+		momentsG: make([]float64, wuTotalSize),
+		momentsB: make([]float64, wuTotalSize),
+		moments:  make([]float64, wuTotalSize),
+	}
+	q.constructHistogram(pixels)
+	q.computeMoments()
+	boxes := q.createBoxes(count)
+
+	populations := make(map[color.RGBA]int)
+	for _, box := range boxes {
+		weight := q.volume(box, q.weights)
+		if weight <= 0 {
+			continue
+		}
+		c := color.RGBA{
+			R: uint8(math.Round(q.volume(box, q.momentsR) / weight)),
+			G: uint8(math.Round(q.volume(box, q.momentsG) / weight)),
+			B: uint8(math.Round(q.volume(box, q.momentsB) / weight)),
+			A: 255,
+		}
+		populations[c] += int(weight)
+	}
+	return populations
+}
+
+func (q *wuQuantizer) constructHistogram(pixels []color.RGBA) {
+	const bitsToRemove = 8 - wuIndexBits
+	for _, p := range pixels {
+		r, g, b := float64(p.R), float64(p.G), float64(p.B)
+		index := wuIndex(int(p.R>>bitsToRemove)+1, int(p.G>>bitsToRemove)+1, int(p.B>>bitsToRemove)+1)
+		q.weights[index]++
+		q.momentsR[index] += r
+		q.momentsG[index] += g
+		q.momentsB[index] += b
+		q.moments[index] += r*r + g*g + b*b
+	}
+}
+
+// computeMoments turns the histogram into cumulative sums, so the moments
+// of any box can be read from its eight corners.
+func (q *wuQuantizer) computeMoments() {
+	for r := 1; r < wuSideLength; r++ {
+		var area, areaR, areaG, areaB, area2 [wuSideLength]float64
+		for g := 1; g < wuSideLength; g++ {
+			var line, lineR, lineG, lineB, line2 float64
+			for b := 1; b < wuSideLength; b++ {
+				index := wuIndex(r, g, b)
+				line += q.weights[index]
+				lineR += q.momentsR[index]
+				lineG += q.momentsG[index]
+				lineB += q.momentsB[index]
+				line2 += q.moments[index]
+
+				area[b] += line
+				areaR[b] += lineR
+				areaG[b] += lineG
+				areaB[b] += lineB
+				area2[b] += line2
+
+				previous := wuIndex(r-1, g, b)
+				q.weights[index] = q.weights[previous] + area[b]
+				q.momentsR[index] = q.momentsR[previous] + areaR[b]
+				q.momentsG[index] = q.momentsG[previous] + areaG[b]
+				q.momentsB[index] = q.momentsB[previous] + areaB[b]
+				q.moments[index] = q.moments[previous] + area2[b]
+			}
+		}
+	}
+}
+
+func (q *wuQuantizer) createBoxes(count int) []wuBox {
+	boxes := make([]wuBox, count)
+	boxes[0] = wuBox{r1: wuSideLength - 1, g1: wuSideLength - 1, b1: wuSideLength - 1}
+	variances := make([]float64, count)
+
+	generated := count
+	next := 0
+	for i := 1; i < count; i++ {
+		if q.cut(&boxes[next], &boxes[i]) {
+			variances[next] = q.boxVariance(boxes[next])
+			variances[i] = q.boxVariance(boxes[i])
+		} else {
+			variances[next] = 0
+			i--
+		}
+
+		next = 0
+		best := variances[0]
+		for j := 1; j <= i; j++ {
+			if variances[j] > best {
+				best = variances[j]
+				next = j
+			}
+		}
+		if best <= 0 {
+			generated = i + 1
+			break
+		}
+	}
+	return boxes[:generated]
+}
+
+func (q *wuQuantizer) boxVariance(box wuBox) float64 {
+	if box.vol <= 1 {
+		return 0
+	}
+	dr := q.volume(box, q.momentsR)
+	dg := q.volume(box, q.momentsG)
+	db := q.volume(box, q.momentsB)
+	xx := q.volume(box, q.moments)
+	return xx - (dr*dr+dg*dg+db*db)/q.volume(box, q.weights)
+}
+
+// cut splits one along the axis that separates it best, moving the upper
+// part into two.
+func (q *wuQuantizer) cut(one, two *wuBox) bool {
+	wholeR := q.volume(*one, q.momentsR)
+	wholeG := q.volume(*one, q.momentsG)
+	wholeB := q.volume(*one, q.momentsB)
+	wholeW := q.volume(*one, q.weights)
+
+	cutR, maxR := q.maximize(*one, 0, one.r0+1, one.r1, wholeR, wholeG, wholeB, wholeW)
+	cutG, maxG := q.maximize(*one, 1, one.g0+1, one.g1, wholeR, wholeG, wholeB, wholeW)
+	cutB, maxB := q.maximize(*one, 2, one.b0+1, one.b1, wholeR, wholeG, wholeB, wholeW)
+
+	two.r1, two.g1, two.b1 = one.r1, one.g1, one.b1
+	switch {
+	case maxR >= maxG && maxR >= maxB:
+		if cutR < 0 {
+			return false
+		}
+		one.r1 = cutR
+		two.r0, two.g0, two.b0 = one.r1, one.g0, one.b0
+	case maxG >= maxR && maxG >= maxB:
+		one.g1 = cutG
+		two.r0, two.g0, two.b0 = one.r0, one.g1, one.b0
+	default:
+		one.b1 = cutB
+		two.r0, two.g0, two.b0 = one.r0, one.g0, one.b1
+	}
+
+	one.vol = (one.r1 - one.r0) * (one.g1 - one.g0) * (one.b1 - one.b0)
+	two.vol = (two.r1 - two.r0) * (two.g1 - two.g0) * (two.b1 - two.b0)
+	return true
+}
+
+func (q *wuQuantizer) maximize(box wuBox, axis, first, last int, wholeR, wholeG, wholeB, wholeW float64) (int, float64) {
+	bottomR := q.bottom(box, axis, q.momentsR)
+	bottomG := q.bottom(box, axis, q.momentsG)
+	bottomB := q.bottom(box, axis, q.momentsB)
+	bottomW := q.bottom(box, axis, q.weights)
+
+	best, cut := 0.0, -1
+	for i := first; i < last; i++ {
+		halfR := bottomR + q.top(box, axis, i, q.momentsR)
+		halfG := bottomG + q.top(box, axis, i, q.momentsG)
+		halfB := bottomB + q.top(box, axis, i, q.momentsB)
+		halfW := bottomW + q.top(box, axis, i, q.weights)
+		if halfW == 0 {
+			continue
+		}
+		temp := (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+
+		halfR, halfG, halfB, halfW = wholeR-halfR, wholeG-halfG, wholeB-halfB, wholeW-halfW
+		if halfW == 0 {
+			continue
+		}
+		temp += (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+
+		if temp > best {
+			best, cut = temp, i
+		}
+	}
+	return cut, best
+}
+
+func (q *wuQuantizer) volume(box wuBox, moment []float64) float64 {
+	return moment[wuIndex(box.r1, box.g1, box.b1)] -
+		moment[wuIndex(box.r1, box.g1, box.b0)] -
+		moment[wuIndex(box.r1, box.g0, box.b1)] +
+		moment[wuIndex(box.r1, box.g0, box.b0)] -
+		moment[wuIndex(box.r0, box.g1, box.b1)] +
+		moment[wuIndex(box.r0, box.g1, box.b0)] +
+		moment[wuIndex(box.r0, box.g0, box.b1)] -
+		moment[wuIndex(box.r0, box.g0, box.b0)]
+}
+
+func (q *wuQuantizer) bottom(box wuBox, axis int, moment []float64) float64 {
+	switch axis {
+	case 0:
+		return -moment[wuIndex(box.r0, box.g1, box.b1)] +
+			moment[wuIndex(box.r0, box.g1, box.b0)] +
+			moment[wuIndex(box.r0, box.g0, box.b1)] -
+			moment[wuIndex(box.r0, box.g0, box.b0)]
+	case 1:
+		return -moment[wuIndex(box.r1, box.g0, box.b1)] +
+			moment[wuIndex(box.r1, box.g0, box.b0)] +
+			moment[wuIndex(box.r0, box.g0, box.b1)] -
+			moment[wuIndex(box.r0, box.g0, box.b0)]
+	default:
+		return -moment[wuIndex(box.r1, box.g1, box.b0)] +
+			moment[wuIndex(box.r1, box.g0, box.b0)] +
+			moment[wuIndex(box.r0, box.g1, box.b0)] -
+			moment[wuIndex(box.r0, box.g0, box.b0)]
+	}
+}
+
+func (q *wuQuantizer) top(box wuBox, axis, position int, moment []float64) float64 {
+	switch axis {
+	case 0:
+		return moment[wuIndex(position, box.g1, box.b1)] -
+			moment[wuIndex(position, box.g1, box.b0)] -
+			moment[wuIndex(position, box.g0, box.b1)] +
+			moment[wuIndex(position, box.g0, box.b0)]
+	case 1:
+		return moment[wuIndex(box.r1, position, box.b1)] -
+			moment[wuIndex(box.r1, position, box.b0)] -
+			moment[wuIndex(box.r0, position, box.b1)] +
+			moment[wuIndex(box.r0, position, box.b0)]
+	default:
+		return moment[wuIndex(box.r1, box.g1, position)] -
+			moment[wuIndex(box.r1, box.g0, position)] -
+			moment[wuIndex(box.r0, box.g1, position)] +
+			moment[wuIndex(box.r0, box.g0, position)]
+	}
+}
+
+// Weighted k-means in CIE Lab, after Material Color Utilities' WSMeans.
+// Each unique color is one point weighted by how often it occurs.
+
+const (
+	wsmeansMaxIterations = 10
+	wsmeansMinMovement   = 3.0 // Lab distance a point must gain to switch cluster
+)
+
+// quantizeWsmeans clusters pixels into at most count colors. Clusters
+// start at starting when given, otherwise at k-means++ picks.
+func quantizeWsmeans(pixels []color.RGBA, starting []color.RGBA, count int) map[color.RGBA]int {
+	counts := make(map[color.RGBA]int)
+	for _, p := range pixels {
+		counts[p]++
+	}
+	if len(counts) == 0 {
+		return counts
+	}
+
+	unique := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		unique = append(unique, c)
+	}
+	sort.Slice(unique, func(i, j int) bool { return rgbKey(unique[i]) < rgbKey(unique[j]) })
+
+	points := make([][3]float64, len(unique))
+	weights := make([]float64, len(unique))
+	for i, c := range unique {
+		points[i] = labFromRgb(c)
+		weights[i] = float64(counts[c])
+	}
+
+	count = min(count, len(points))
+	var clusters [][3]float64
+	if len(starting) > 0 {
+		for _, c := range starting[:min(count, len(starting))] {
+			clusters = append(clusters, labFromRgb(c))
+		}
+	} else {
+		clusters = kmeansPlusPlus(points, weights, count)
+	}
+
+	assignments := make([]int, len(points))
+	for i, p := range points {
+		assignments[i] = nearestCluster(p, clusters)
+	}
+
+	clusterDistances := make([][]float64, len(clusters))
+	for i := range clusterDistances {
+		clusterDistances[i] = make([]float64, len(clusters))
+	}
+
+	for iteration := 0; iteration < wsmeansMaxIterations; iteration++ {
+		updateCentroids(points, weights, assignments, clusters)
+
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				d := labDistance(clusters[i], clusters[j])
+				clusterDistances[i][j], clusterDistances[j][i] = d, d
+			}
+		}
+
+		moved := 0
+		for i, p := range points {
+			previous := assignments[i]
+			previousDistance := labDistance(p, clusters[previous])
+			best, bestDistance := previous, previousDistance
+			for j := range clusters {
+				// By the triangle inequality, j can't be closer.
+				if j == previous || clusterDistances[previous][j] >= 4*previousDistance {
+					continue
+				}
+				if d := labDistance(p, clusters[j]); d < bestDistance {
+					best, bestDistance = j, d
+				}
+			}
+			if best != previous && math.Abs(math.Sqrt(bestDistance)-math.Sqrt(previousDistance)) > wsmeansMinMovement {
+				assignments[i] = best
+				moved++
+			}
+		}
+		if moved == 0 {
+			break
+		}
+	}
+	populations := updateCentroids(points, weights, assignments, clusters)
+
+	result := make(map[color.RGBA]int)
+	for i, cluster := range clusters {
+		if populations[i] == 0 {
+			continue
+		}
+		result[rgbFromLab(cluster)] += int(populations[i])
+	}
+	return result
+}
+
+// updateCentroids moves every cluster to the weighted mean of its points
+// and returns the clusters' populations. Empty clusters stay in place.
+func updateCentroids(points [][3]float64, weights []float64, assignments []int, clusters [][3]float64) []float64 {
+	sums := make([][3]float64, len(clusters))
+	populations := make([]float64, len(clusters))
+	for i, p := range points {
+		c := assignments[i]
+		populations[c] += weights[i]
+		for k := range p {
+			sums[c][k] += p[k] * weights[i]
+		}
+	}
+	for i := range clusters {
+		if populations[i] == 0 {
+			continue
+		}
+		for k := range sums[i] {
+			clusters[i][k] = sums[i][k] / populations[i]
+		}
+	}
+	return populations
+}
+
+// kmeansPlusPlus picks count starting clusters, each new one with
+// probability proportional to its weighted squared distance from the
+// clusters picked so far. The seed is fixed so results are reproducible.
+func kmeansPlusPlus(points [][3]float64, weights []float64, count int) [][3]float64 {
+	rng := rand.New(rand.NewSource(0x42688))
+
+	first, total := 0, 0.0
+	for i, w := range weights {
+		total += w
+		if rng.Float64()*total < w {
+			first = i
+		}
+	}
+	clusters := [][3]float64{points[first]}
+
+	distances := make([]float64, len(points))
+	for i, p := range points {
+		distances[i] = labDistance(p, points[first])
+	}
+	for len(clusters) < count {
+		sum := 0.0
+		for i, d := range distances {
+			sum += d * weights[i]
+		}
+		if sum == 0 {
+			break
+		}
+
+		target := rng.Float64() * sum
+		next := len(points) - 1
+		for i, d := range distances {
+			target -= d * weights[i]
+			if target <= 0 {
+				next = i
+				break
+			}
+		}
+		clusters = append(clusters, points[next])
+		for i, p := range points {
+			distances[i] = math.Min(distances[i], labDistance(p, points[next]))
+		}
+	}
+	return clusters
+}
+
+func nearestCluster(point [3]float64, clusters [][3]float64) int {
+	best, bestDistance := 0, math.Inf(1)
+	for i, c := range clusters {
+		if d := labDistance(point, c); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
+
+// labDistance is the squared Euclidean distance between two Lab colors.
+func labDistance(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dl*dl + da*da + db*db
+}
+
+var xyzToSrgb = invertMatrix(srgbToXyz)
+
+func labFromRgb(c color.RGBA) [3]float64 {
+	xyz := rgbToXyz(c)
+	fx := labF(xyz[0] / whitePointD65[0])
+	fy := labF(xyz[1] / whitePointD65[1])
+	fz := labF(xyz[2] / whitePointD65[2])
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func rgbFromLab(lab [3]float64) color.RGBA {
+	fy := (lab[0] + 16) / 116
+	fx := lab[1]/500 + fy
+	fz := fy - lab[2]/200
+	xyz := [3]float64{
+		labInvf(fx) * whitePointD65[0],
+		labInvf(fy) * whitePointD65[1],
+		labInvf(fz) * whitePointD65[2],
+	}
+	return rgbFromLinrgb(matrixMultiply(xyz, xyzToSrgb))
+}
+
+// Ranking after Material Color Utilities' Score: colors are scored by how
+// much of the image their hue family covers and by chroma, then picked
+// best first while keeping hues apart.
+
+const (
+	scoreTargetChroma          = 48.0
+	scoreWeightProportion      = 0.7
+	scoreWeightChromaAbove     = 0.3
+	scoreWeightChromaBelow     = 0.1
+	scoreCutoffChroma          = 5.0
+	scoreCutoffExcitedFraction = 0.01
+)
+
+// colorScore is a color's standing in Material's Score.
+type colorScore struct {
+	HCT     HCT
+	Excited float64 // Share of the image within ±15° of its hue
+	Score   float64
+}
+
+// scorePopulations scores every color by the share of the image its hue
+// family covers and by its chroma.
+func scorePopulations(populations map[color.RGBA]int) map[color.RGBA]colorScore {
+	var huePopulation [360]float64
+	total := 0.0
+	hcts := make(map[color.RGBA]HCT, len(populations))
+	for c, population := range populations {
+		hct := rgbToHct(c)
+		hcts[c] = hct
+		huePopulation[int(math.Floor(hct.H))%360] += float64(population)
+		total += float64(population)
+	}
+
+	// Each hue is credited with the population of its ±15° neighborhood.
+	var excited [360]float64
+	for hue := 0; total > 0 && hue < 360; hue++ {
+		proportion := huePopulation[hue] / total
+		for i := hue - 14; i < hue+16; i++ {
+			excited[(i+360)%360] += proportion
+		}
+	}
+
+	scores := make(map[color.RGBA]colorScore, len(populations))
+	for c, hct := range hcts {
+		proportion := excited[int(math.Round(hct.H))%360]
+		chromaWeight := scoreWeightChromaAbove
+		if hct.C < scoreTargetChroma {
+			chromaWeight = scoreWeightChromaBelow
+		}
+		scores[c] = colorScore{
+			HCT:     hct,
+			Excited: proportion,
+			Score:   proportion*100*scoreWeightProportion + (hct.C-scoreTargetChroma)*chromaWeight,
+		}
+	}
+	return scores
+}
+
+// scoreColors returns up to desired colorful colors, best first, keeping
+// their hues as far apart as the palette allows.
+func scoreColors(populations map[color.RGBA]int, desired int) []color.RGBA {
+	scores := scorePopulations(populations)
+
+	var candidates []color.RGBA
+	for _, s := range byPopulation(populations) {
+		score := scores[s.Color]
+		if score.HCT.C < scoreCutoffChroma || score.Excited <= scoreCutoffExcitedFraction {
+			continue
+		}
+		candidates = append(candidates, s.Color)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i]].Score > scores[candidates[j]].Score
+	})
+
+	// Ask for the widest hue spacing that still yields enough colors.
+	var chosen []color.RGBA
+	for spacing := 90.0; spacing >= 15; spacing-- {
+		chosen = chosen[:0]
+		for _, candidate := range candidates {
+			distinct := true
+			for _, c := range chosen {
+				if calculateHueDistance(scores[candidate].HCT.H, scores[c].HCT.H) < spacing {
+					distinct = false
+					break
+				}
+			}
+			if distinct {
+				chosen = append(chosen, candidate)
+			}
+			if len(chosen) >= desired {
+				break
+			}
+		}
+		if len(chosen) >= desired {
+			break
+		}
+	}
+	return chosen
+}
+
+// describeSwatches fills in the metrics derived from each swatch's color
+// and population.
+func describeSwatches(swatches []Swatch) {
+	populations := make(map[color.RGBA]int, len(swatches))
+	total := 0
+	for _, s := range swatches {
+		populations[s.Color] += s.Population
+		total += s.Population
+	}
+	scores := scorePopulations(populations)
+
+	for i := range swatches {
+		score := scores[swatches[i].Color]
+		swatches[i].HCT = score.HCT
+		swatches[i].Score = score.Score
+		if total > 0 {
+			swatches[i].Proportion = float64(swatches[i].Population) / float64(total)
+		}
+	}
+}
@@ -9,6 +9,10 @@ var rootCmd = &cobra.Command{
 	Short: "archThemeM0d helps you to build cohesive themes across your systems based off your wallpaper.",
 }
 
+// Version is the archThemeM0d version, set by main from the build flags.
+var Version = "dev"
+
 func Execute() {
+	rootCmd.Version = Version
 	cobra.CheckErr(rootCmd.Execute())
 }
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// themeSeeds are the colors picked from the wallpaper for each key role.
+type themeSeeds struct {
+	Primary        HCT
+	Secondary      HCT
+	Tertiary       HCT
+	Neutral        HCT
+	NeutralVariant HCT // Surface variants and outlines
+}
+
+// schemeVariant defines how the key palettes of a scheme derive from the
+// wallpaper's seeds. Apart from "wallpaper", every variant follows one of
+// Material's dynamic color schemes (SchemeTonalSpot, SchemeFidelity, ...)
+// and only looks at the primary seed.
+type schemeVariant struct {
+	Name        string
+	Description string
+	keyColors   func(seeds themeSeeds) themeSeeds
+}
+
+const defaultSchemeVariant = "wallpaper"
+
+var schemeVariants = []schemeVariant{
+	{
+		Name:        "wallpaper",
+		Description: "each role keeps the wallpaper color it was matched to",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			return seeds
+		},
+	},
+	{
+		Name:        "tonalspot",
+		Description: "Material's default: calm, low-chroma accents around the seed hue",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			h := seeds.Primary.H
+			return themeSeeds{
+				Primary:        HCT{H: h, C: 36},
+				Secondary:      HCT{H: h, C: 16},
+				Tertiary:       HCT{H: sanitizeDegrees(h + 60), C: 24},
+				Neutral:        HCT{H: h, C: 6},
+				NeutralVariant: HCT{H: h, C: 8},
+			}
+		},
+	},
+	{
+		Name:        "vibrant",
+		Description: "maximum chroma primary with hue-shifted accents",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			h := seeds.Primary.H
+			hues := []float64{0, 41, 61, 101, 131, 181, 251, 301, 360}
+			return themeSeeds{
+				Primary:        HCT{H: h, C: 200},
+				Secondary:      HCT{H: rotateHue(h, hues, []float64{18, 15, 10, 12, 15, 18, 15, 12, 12}), C: 24},
+				Tertiary:       HCT{H: rotateHue(h, hues, []float64{35, 30, 20, 25, 30, 35, 30, 25, 25}), C: 32},
+				Neutral:        HCT{H: h, C: 10},
+				NeutralVariant: HCT{H: h, C: 12},
+			}
+		},
+	},
+	{
+		Name:        "expressive",
+		Description: "playful: the primary hue moves away from the seed",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			h := seeds.Primary.H
+			hues := []float64{0, 21, 51, 121, 151, 191, 271, 321, 360}
+			return themeSeeds{
+				Primary:        HCT{H: sanitizeDegrees(h + 240), C: 40},
+				Secondary:      HCT{H: rotateHue(h, hues, []float64{45, 95, 45, 20, 45, 90, 45, 45, 45}), C: 24},
+				Tertiary:       HCT{H: rotateHue(h, hues, []float64{120, 120, 20, 45, 20, 15, 20, 120, 120}), C: 32},
+				Neutral:        HCT{H: sanitizeDegrees(h + 15), C: 8},
+				NeutralVariant: HCT{H: sanitizeDegrees(h + 15), C: 12},
+			}
+		},
+	},
+	{
+		Name:        "fidelity",
+		Description: "primary matches the seed's chroma, tertiary is its temperature complement",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			keys := contentKeyColors(seeds.Primary)
+			keys.Tertiary = fixIfDisliked(newTemperatureCache(seeds.Primary).complement())
+			return keys
+		},
+	},
+	{
+		Name:        "content",
+		Description: "primary matches the seed's chroma, tertiary is an analogous color by temperature",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			keys := contentKeyColors(seeds.Primary)
+			keys.Tertiary = fixIfDisliked(newTemperatureCache(seeds.Primary).analogous(3, 6)[2])
+			return keys
+		},
+	},
+	{
+		Name:        "monochrome",
+		Description: "grayscale; only the error palette keeps its color",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			h := seeds.Primary.H
+			return themeSeeds{
+				Primary:        HCT{H: h, C: 0},
+				Secondary:      HCT{H: h, C: 0},
+				Tertiary:       HCT{H: h, C: 0},
+				Neutral:        HCT{H: h, C: 0},
+				NeutralVariant: HCT{H: h, C: 0},
+			}
+		},
+	},
+	{
+		Name:        "neutral",
+		Description: "nearly grayscale with a hint of the seed hue",
+		keyColors: func(seeds themeSeeds) themeSeeds {
+			h := seeds.Primary.H
+			return themeSeeds{
+				Primary:        HCT{H: h, C: 12},
+				Secondary:      HCT{H: h, C: 8},
+				Tertiary:       HCT{H: sanitizeDegrees(h + 60), C: 16},
+				Neutral:        HCT{H: h, C: 2},
+				NeutralVariant: HCT{H: h, C: 2},
+			}
+		},
+	},
+}
+
+// contentKeyColors are the key colors fidelity and content share: every
+// palette but the tertiary keeps the seed's hue, with the primary at the
+// seed's own chroma.
+func contentKeyColors(seed HCT) themeSeeds {
+	h, c := seed.H, seed.C
+	return themeSeeds{
+		Primary:        HCT{H: h, C: c},
+		Secondary:      HCT{H: h, C: math.Max(c-32, c*0.5)},
+		Neutral:        HCT{H: h, C: c / 8},
+		NeutralVariant: HCT{H: h, C: c/8 + 4},
+	}
+}
+
+// findSchemeVariant looks up a variant by name.
+func findSchemeVariant(name string) (schemeVariant, error) {
+	for _, variant := range schemeVariants {
+		if variant.Name == name {
+			return variant, nil
+		}
+	}
+	return schemeVariant{}, fmt.Errorf("unknown scheme %q (valid: %s)", name, strings.Join(schemeVariantNames(), ", "))
+}
+
+func schemeVariantNames() []string {
+	names := make([]string, 0, len(schemeVariants))
+	for _, variant := range schemeVariants {
+		names = append(names, variant.Name)
+	}
+	return names
+}
+
+// rotateHue rotates sourceHue by the rotation of the hue range it falls in.
+// hues must be sorted and span 0-360.
+func rotateHue(sourceHue float64, hues, rotations []float64) float64 {
+	for i := 0; i < len(hues)-1; i++ {
+		if hues[i] <= sourceHue && sourceHue < hues[i+1] {
+			return sanitizeDegrees(sourceHue + rotations[i])
+		}
+	}
+	return sourceHue
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// monitorThemeDir is where a monitor's templates are rendered.
+func monitorThemeDir(monitor string) string {
+	return filepath.Join(homeDir, tm0dDir, "Themes", monitor)
+}
+
+// monitorGroups groups monitors whose themes come out the same because they
+// share the wallpaper, its palette and the seed. Groups and the monitors in
+// them are sorted by name; the first monitor of a group leads it.
+func monitorGroups(monitors []MonitorInfo) [][]MonitorInfo {
+	var groups [][]MonitorInfo
+	index := make(map[string]int)
+	sorted := append([]MonitorInfo(nil), monitors...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Monitor < sorted[j].Monitor
+	})
+
+	for _, m := range sorted {
+		key, err := json.Marshal(m.Theme)
+		if err != nil {
+			groups = append(groups, []MonitorInfo{m})
+			continue
+		}
+		if i, ok := index[string(key)]; ok {
+			groups[i] = append(groups[i], m)
+			continue
+		}
+		index[string(key)] = len(groups)
+		groups = append(groups, []MonitorInfo{m})
+	}
+	return groups
+}
+
+// templatesReferenceMonitor reports whether any of the templates reads the
+// monitor name, in which case monitors sharing a theme still render differently.
+func templatesReferenceMonitor(templatesDir string, templateNames []string) bool {
+	for _, name := range templateNames {
+		if templateReferencesMonitor(templatesDir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateReferencesMonitor parses a template and walks it for anything that
+// reads the monitor name: .Monitor, $.Monitor, a field of a variable bound
+// to the data, or the data printed as a whole. Templates it defines or
+// calls are walked too. It errs on the side of true when the template can't
+// be read or parsed, so the monitor gets its own rendering.
+func templateReferencesMonitor(templatesDir, templateName string) bool {
+	content, err := os.ReadFile(filepath.Join(templatesDir, templateName))
+	if err != nil {
+		return true
+	}
+	tmpl, err := template.New(templateName).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return true
+	}
+
+	w := monitorRefWalker{tmpl: tmpl, visited: make(map[string]bool)}
+	if w.walkTemplate(templateName, true) {
+		return true
+	}
+	// Defined templates that are never called with the data still count
+	// when they read .Monitor off whatever they are given
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && w.walk(t.Tree.Root, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// monitorRefWalker looks for references to TemplateData.Monitor in the
+// parse trees of a template.
+type monitorRefWalker struct {
+	tmpl    *template.Template
+	visited map[string]bool // Templates already walked with the data as dot
+}
+
+// walkTemplate walks the named template once with rootDot, which is true
+// when dot is the TemplateData itself.
+func (w monitorRefWalker) walkTemplate(name string, rootDot bool) bool {
+	t := w.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil || (rootDot && w.visited[name]) {
+		return false
+	}
+	if rootDot {
+		w.visited[name] = true
+	}
+	return w.walk(t.Tree.Root, rootDot)
+}
+
+func (w monitorRefWalker) walk(node parse.Node, rootDot bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if w.walk(child, rootDot) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return w.walk(n.Pipe, rootDot)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if w.walk(arg, rootDot) {
+					return true
+				}
+			}
+		}
+	case *parse.FieldNode:
+		return slices.Contains(n.Ident, "Monitor")
+	case *parse.VariableNode:
+		// $.Monitor or $data.Monitor, or $ handed over whole
+		return slices.Contains(n.Ident[1:], "Monitor") || (len(n.Ident) == 1 && n.Ident[0] == "$")
+	case *parse.ChainNode:
+		return slices.Contains(n.Field, "Monitor") || w.walk(n.Node, rootDot)
+	case *parse.DotNode:
+		// The whole data, printed or passed to a function
+		return rootDot
+	case *parse.IfNode:
+		return w.walk(n.Pipe, rootDot) || w.walk(n.List, rootDot) || w.walk(n.ElseList, rootDot)
+	case *parse.WithNode:
+		// Inside with and range dot is something else, but not in else
+		return w.walk(n.Pipe, rootDot) || w.walk(n.List, false) || w.walk(n.ElseList, rootDot)
+	case *parse.RangeNode:
+		return w.walk(n.Pipe, rootDot) || w.walk(n.List, false) || w.walk(n.ElseList, rootDot)
+	case *parse.TemplateNode:
+		if n.Pipe == nil {
+			return false
+		}
+		if passesData(n.Pipe, rootDot) {
+			return w.walkTemplate(n.Name, true)
+		}
+		return w.walk(n.Pipe, rootDot)
+	}
+	return false
+}
+
+// passesData reports whether a {{template}} call hands over the whole data,
+// as with {{template "name" .}} at the top level or {{template "name" $}}.
+func passesData(pipe *parse.PipeNode, rootDot bool) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return rootDot
+	case *parse.VariableNode:
+		return len(arg.Ident) == 1 && arg.Ident[0] == "$"
+	}
+	return false
+}
+
+// retargetMonitor reuses the classified render targets of one monitor for
+// another monitor sharing its theme.
+func retargetMonitor(targets []renderTarget, from, to string) []renderTarget {
+	retargeted := make([]renderTarget, len(targets))
+	for i, target := range targets {
+		rel, err := filepath.Rel(monitorThemeDir(from), target.Dir)
+		if err != nil {
+			rel = "."
+		}
+		retargeted[i] = target
+		retargeted[i].Dir = filepath.Join(monitorThemeDir(to), rel)
+		retargeted[i].Data.Monitor = to
+	}
+	return retargeted
+}
+
+// themeLinkTarget returns the monitor whose directory a monitor's theme
+// directory links to, or "" when it is a directory of its own.
+func themeLinkTarget(monitor string) string {
+	target, err := os.Readlink(monitorThemeDir(monitor))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// unlinkMonitorTheme removes a monitor's theme directory if it is a link, so
+// rendering into it doesn't write into another monitor's theme.
+func unlinkMonitorTheme(monitor string) error {
+	if themeLinkTarget(monitor) == "" {
+		return nil
+	}
+	return os.Remove(monitorThemeDir(monitor))
+}
+
+// linkMonitorTheme replaces a monitor's theme directory with a relative link
+// to the leader's, which holds the same files.
+func linkMonitorTheme(monitor, leader string) error {
+	dir := monitorThemeDir(monitor)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("could not replace theme directory of %s: %w", monitor, err)
+	}
+	if err := os.Symlink(leader, dir); err != nil {
+		return fmt.Errorf("could not link theme of %s to %s: %w", monitor, leader, err)
+	}
+	return nil
+}
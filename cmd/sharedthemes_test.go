@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateReferencesMonitor(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     bool
+	}{
+		{"colors only", `bg={{ .Theme.Surface | toHex }}`, false},
+		{"range over colors", `{{ range .Theme.Terminal.Colors }}{{ toHex . }}{{ end }}`, false},
+		{"the word in text", `# Monitor colors`, false},
+		{"field", `# {{ .Monitor }}`, true},
+		{"root variable", `{{ with .Theme }}{{ $.Monitor }}{{ end }}`, true},
+		{"with", `{{ with .Monitor }}output {{ . }}{{ end }}`, true},
+		{"bound variable", `{{ $data := . }}{{ range .Theme.Terminal.Colors }}{{ $data.Monitor }}{{ end }}`, true},
+		{"printed data", `{{ printf "%v" . }}`, true},
+		{"dot in else", `{{ with .Theme.Seed }}{{ . }}{{ else }}{{ . }}{{ end }}`, true},
+		{"nested template", `{{ define "name" }}{{ .Monitor }}{{ end }}{{ template "name" . }}`, true},
+		{"template given the data", `{{ define "dump" }}{{ . }}{{ end }}{{ template "dump" $ }}`, true},
+		{"template given a color", `{{ define "hex" }}{{ toHex . }}{{ end }}{{ template "hex" .Theme.Primary.KeyColor }}`, false},
+		{"unparsable", `{{ .Theme.Surface | toHex `, true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Base(t.Name()) + ".tmpl"
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(tt.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := templateReferencesMonitor(dir, name); got != tt.want {
+				t.Errorf("templateReferencesMonitor(%q) = %t, want %t", tt.template, got, tt.want)
+			}
+		})
+	}
+}
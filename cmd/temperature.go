@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"image/color"
+	"math"
+)
+
+// temperatureCache finds complementary and analogous colors by color
+// temperature, after Material Color Utilities' TemperatureCache. Every hue
+// is solved at the chroma and tone of the input, and compared by how warm
+// it looks rather than by hue angle.
+type temperatureCache struct {
+	input     HCT
+	hctsByHue [361]HCT     // Index is the hue in degrees, 0 to 360
+	tempByHue [361]float64 // rawTemperature of hctsByHue
+	inputTemp float64
+	coldest   HCT
+	warmest   HCT
+	coldTemp  float64 // rawTemperature of coldest
+	warmTemp  float64 // rawTemperature of warmest
+}
+
+func newTemperatureCache(input HCT) *temperatureCache {
+	tc := &temperatureCache{input: input, inputTemp: rawTemperature(hctToRgb(input))}
+	for hue := range tc.hctsByHue {
+		c := hctToRgb(HCT{H: float64(hue), C: input.C, T: input.T})
+		tc.hctsByHue[hue] = rgbToHct(c)
+		tc.tempByHue[hue] = rawTemperature(c)
+	}
+
+	// The input counts too, after every hue
+	tc.coldest, tc.coldTemp = tc.hctsByHue[0], tc.tempByHue[0]
+	tc.warmest, tc.warmTemp = tc.hctsByHue[0], tc.tempByHue[0]
+	candidates := append(tc.hctsByHue[:], input)
+	for i, hct := range candidates {
+		temp := tc.inputTemp
+		if i < len(tc.tempByHue) {
+			temp = tc.tempByHue[i]
+		}
+		if temp < tc.coldTemp {
+			tc.coldest, tc.coldTemp = hct, temp
+		}
+		if temp >= tc.warmTemp {
+			tc.warmest, tc.warmTemp = hct, temp
+		}
+	}
+	return tc
+}
+
+// rawTemperature is Ou, Woodcock and Wright's temperature of a color from
+// its Lab coordinates: below 0 is cool, above 0 warm.
+func rawTemperature(c color.RGBA) float64 {
+	lab := labFromRgb(c)
+	hue := sanitizeDegrees(math.Atan2(lab[2], lab[1]) * 180 / math.Pi)
+	chroma := math.Hypot(lab[1], lab[2])
+	return -0.5 + 0.02*math.Pow(chroma, 1.07)*math.Cos(sanitizeDegrees(hue-50)*math.Pi/180)
+}
+
+// relativeTemperature places a raw temperature between the coldest (0)
+// and warmest (1) colors of the cache.
+func (tc *temperatureCache) relativeTemperature(temp float64) float64 {
+	if tc.warmTemp == tc.coldTemp {
+		return 0.5
+	}
+	return (temp - tc.coldTemp) / (tc.warmTemp - tc.coldTemp)
+}
+
+// complement is the color on the other side of the temperature scale,
+// found on the arc of hues between the coldest and warmest colors that
+// does not hold the input.
+func (tc *temperatureCache) complement() HCT {
+	coldestHue, warmestHue := tc.coldest.H, tc.warmest.H
+	startHue, endHue := coldestHue, warmestHue
+	if isHueBetween(tc.input.H, coldestHue, warmestHue) {
+		startHue, endHue = warmestHue, coldestHue
+	}
+
+	complementTemp := 1 - tc.relativeTemperature(tc.inputTemp)
+	answer := tc.hctsByHue[int(math.Round(tc.input.H))]
+	smallestError := 1000.0
+	for addend := 0; addend <= 360; addend++ {
+		hue := sanitizeDegrees(startHue + float64(addend))
+		if !isHueBetween(hue, startHue, endHue) {
+			continue
+		}
+		i := int(math.Round(hue))
+		if err := math.Abs(complementTemp - tc.relativeTemperature(tc.tempByHue[i])); err < smallestError {
+			smallestError = err
+			answer = tc.hctsByHue[i]
+		}
+	}
+	return answer
+}
+
+// analogous returns count colors around the input, which is in the middle,
+// spaced evenly in temperature over divisions steps of the whole wheel.
+func (tc *temperatureCache) analogous(count, divisions int) []HCT {
+	startHue := int(math.Round(tc.input.H)) % 360
+	relative := func(hue int) float64 {
+		return tc.relativeTemperature(tc.tempByHue[hue%360])
+	}
+
+	// How much the temperature changes going once around the wheel
+	totalTempDelta := 0.0
+	lastTemp := relative(startHue)
+	for i := 0; i < 360; i++ {
+		temp := relative(startHue + i)
+		totalTempDelta += math.Abs(temp - lastTemp)
+		lastTemp = temp
+	}
+
+	colors := []HCT{tc.hctsByHue[startHue]}
+	tempStep := totalTempDelta / float64(divisions)
+	totalTempDelta = 0
+	lastTemp = relative(startHue)
+	for addend := 1; len(colors) < divisions; addend++ {
+		hct := tc.hctsByHue[(startHue+addend)%360]
+		temp := relative(startHue + addend)
+		totalTempDelta += math.Abs(temp - lastTemp)
+		lastTemp = temp
+
+		for step := 1; len(colors) < divisions && totalTempDelta >= float64(len(colors)+step-1)*tempStep; step++ {
+			colors = append(colors, hct)
+		}
+		if addend >= 360 {
+			for len(colors) < divisions {
+				colors = append(colors, hct)
+			}
+		}
+	}
+
+	answers := []HCT{tc.input}
+	ccw := (count - 1) / 2
+	for i := 1; i <= ccw; i++ {
+		index := ((-i)%len(colors) + len(colors)) % len(colors)
+		answers = append([]HCT{colors[index]}, answers...)
+	}
+	for i := 1; i <= count-ccw-1; i++ {
+		answers = append(answers, colors[i%len(colors)])
+	}
+	return answers
+}
+
+// isHueBetween reports whether angle lies on the arc from a to b, going
+// clockwise.
+func isHueBetween(angle, a, b float64) bool {
+	if a < b {
+		return a <= angle && angle <= b
+	}
+	return a <= angle || angle <= b
+}
+
+// fixIfDisliked lightens dark yellow-greens, which are universally
+// disliked, after Material Color Utilities' DislikeAnalyzer.
+func fixIfDisliked(hct HCT) HCT {
+	hue, chroma, tone := math.Round(hct.H), math.Round(hct.C), math.Round(hct.T)
+	if hue >= 90 && hue <= 111 && chroma > 16 && tone < 65 {
+		return rgbToHct(hctToRgb(HCT{H: hct.H, C: hct.C, T: 70}))
+	}
+	return hct
+}
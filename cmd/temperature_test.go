@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// The expected colors are those of Material Color Utilities' own
+// TemperatureCache tests.
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func mustHex(t *testing.T, hex string) color.RGBA {
+	t.Helper()
+	c, err := parseHexColor(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRawTemperature(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want float64
+	}{
+		{"#0000ff", -1.393},
+		{"#ff0000", 2.351},
+		{"#00ff00", -0.267},
+		{"#ffffff", -0.5},
+		{"#000000", -0.5},
+	}
+	for _, tt := range tests {
+		if got := rawTemperature(mustHex(t, tt.hex)); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("rawTemperature(%s) = %.3f, want %.3f", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestTemperatureComplement(t *testing.T) {
+	tests := []struct{ hex, want string }{
+		{"#0000ff", "#9d0002"},
+		{"#ff0000", "#007bfc"},
+		{"#00ff00", "#ffd2c9"},
+		{"#ffffff", "#ffffff"},
+		{"#000000", "#000000"},
+	}
+	for _, tt := range tests {
+		tc := newTemperatureCache(rgbToHct(mustHex(t, tt.hex)))
+		if got := hexColor(hctToRgb(tc.complement())); got != tt.want {
+			t.Errorf("complement of %s = %s, want %s", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestTemperatureAnalogous(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want [5]string
+	}{
+		{"#0000ff", [5]string{"#00590c", "#00564e", "#0000ff", "#6700cc", "#81009f"}},
+		{"#ff0000", [5]string{"#f60082", "#fc004c", "#ff0000", "#d95500", "#af7200"}},
+		{"#000000", [5]string{"#000000", "#000000", "#000000", "#000000", "#000000"}},
+	}
+	for _, tt := range tests {
+		tc := newTemperatureCache(rgbToHct(mustHex(t, tt.hex)))
+		analogous := tc.analogous(5, 12)
+		var got [5]string
+		for i, hct := range analogous {
+			got[i] = hexColor(hctToRgb(hct))
+		}
+		if got != tt.want {
+			t.Errorf("analogous of %s = %v, want %v", tt.hex, got, tt.want)
+		}
+	}
+}
@@ -1,193 +1,241 @@
 package cmd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"image/color"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/spf13/cobra"
 )
 
-// TonalPalette holds a map of tones for a single color role.
-// The key is the tone level (0, 10, 20, ..., 100).
+// TonalPalette is every tone of a single color role. Tones holds the
+// standard Material 3 levels (0, 10, 20, ..., 100, plus 95 and 99); any
+// other tone from 0 to 100 is solved from KeyColor on demand by Tone.
 type TonalPalette struct {
-	Tones map[int]color.RGBA
+	Tones    map[int]color.RGBA
+	KeyColor HCT // Hue and chroma every tone is solved for
+
+	cache *toneCache
+}
+
+// toneCache remembers tones computed on demand. It is shared by copies of
+// the palette.
+type toneCache struct {
+	mu    sync.Mutex
+	tones map[float64]color.RGBA
+}
+
+// Tone returns the palette's color at any tone from 0 to 100, including
+// fractional tones.
+func (p TonalPalette) Tone(tone float64) color.RGBA {
+	if c, ok := p.Tones[int(tone)]; ok && float64(int(tone)) == tone {
+		return c
+	}
+	if p.cache == nil {
+		return hctToRgb(HCT{H: p.KeyColor.H, C: p.KeyColor.C, T: tone})
+	}
+
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	if c, ok := p.cache.tones[tone]; ok {
+		return c
+	}
+	c := hctToRgb(HCT{H: p.KeyColor.H, C: p.KeyColor.C, T: tone})
+	p.cache.tones[tone] = c
+	return c
+}
+
+// ColorRoles is the Material 3 role quartet for one accent color.
+type ColorRoles struct {
+	Color       color.RGBA // Filled buttons, active states
+	OnColor     color.RGBA // Text and icons on Color
+	Container   color.RGBA // Tonal buttons, chips, less prominent fills
+	OnContainer color.RGBA // Text and icons on Container
 }
 
 // ClassifiedTheme is a Material-inspired theme structure.
 // It holds full tonal palettes for key roles and specific colors for surfaces.
 type ClassifiedTheme struct {
-	Primary   TonalPalette
-	Secondary TonalPalette
-	Tertiary  TonalPalette
-	Neutral   TonalPalette
-
-	// Surface colors for dark theme
+	Primary        TonalPalette
+	Secondary      TonalPalette
+	Tertiary       TonalPalette
+	Neutral        TonalPalette
+	NeutralVariant TonalPalette // Surface variants and outlines
+	Error          TonalPalette
+
+	IsDark bool // Whether the roles below are for a dark or light scheme
+
+	// Accent roles
+	PrimaryRoles   ColorRoles
+	SecondaryRoles ColorRoles
+	TertiaryRoles  ColorRoles
+	ErrorRoles     ColorRoles
+
+	// Surface colors
+	Background       color.RGBA // Behind all content
+	OnBackground     color.RGBA // Text on Background
 	Surface          color.RGBA // App backgrounds
 	SurfaceVariant   color.RGBA // Cards, dialogs
 	OnSurface        color.RGBA // Text on Surface
 	OnSurfaceVariant color.RGBA // Secondary text
-	PrimaryFixed     color.RGBA // A primary color that doesn't change
-	OnPrimaryFixed   color.RGBA // Text on PrimaryFixed
+	SurfaceTint      color.RGBA // Elevation overlay
+
+	// Surface containers, from least to most emphasized
+	SurfaceDim              color.RGBA
+	SurfaceBright           color.RGBA
+	SurfaceContainerLowest  color.RGBA
+	SurfaceContainerLow     color.RGBA
+	SurfaceContainer        color.RGBA
+	SurfaceContainerHigh    color.RGBA
+	SurfaceContainerHighest color.RGBA
+
+	// Inverse colors for elements that contrast with the surrounding UI,
+	// such as snackbars
+	InverseSurface   color.RGBA
+	InverseOnSurface color.RGBA
+	InversePrimary   color.RGBA
+
+	// Outlines and overlays
+	Outline        color.RGBA // Borders, dividers with emphasis
+	OutlineVariant color.RGBA // Decorative dividers
+	Scrim          color.RGBA // Behind modals
+	Shadow         color.RGBA
+
+	// Fixed colors keep the same tone in dark and light schemes
+	PrimaryFixed            color.RGBA // A primary color that doesn't change
+	PrimaryFixedDim         color.RGBA
+	OnPrimaryFixed          color.RGBA // Text on PrimaryFixed
+	OnPrimaryFixedVariant   color.RGBA
+	SecondaryFixed          color.RGBA
+	SecondaryFixedDim       color.RGBA
+	OnSecondaryFixed        color.RGBA
+	OnSecondaryFixedVariant color.RGBA
+	TertiaryFixed           color.RGBA
+	TertiaryFixedDim        color.RGBA
+	OnTertiaryFixed         color.RGBA
+	OnTertiaryFixedVariant  color.RGBA
+
+	// User-defined colors from customcolors.json, by name
+	Custom map[string]*CustomColor
+
+	// ANSI colors for terminals, tinted by the theme
+	Terminal TerminalPalette
+
+	// Contrast ratios of the role pairs above, after applying --contrast
+	Contrast []ContrastResult
 }
 
-// HCT represents a color in Hue, Chroma, Tone space (Material 3's color space)
-type HCT struct {
-	H float64 // Hue (0-360)
-	C float64 // Chroma (0-100+)
-	T float64 // Tone (0-100)
+// schemePalettes are the tonal palettes a scheme's roles are picked from.
+type schemePalettes struct {
+	Primary        TonalPalette
+	Secondary      TonalPalette
+	Tertiary       TonalPalette
+	Neutral        TonalPalette
+	NeutralVariant TonalPalette
+	Error          TonalPalette
+	Custom         map[string]TonalPalette
+	Terminal       [6]TonalPalette // ANSI red, green, yellow, blue, magenta, cyan
 }
 
+// errorSeed is Material 3's baseline error color. Its hue is harmonized
+// toward the primary seed before use.
+var errorSeed = HCT{H: 25, C: 84, T: 40}
+
 // colorMetrics is a helper struct for color analysis and sorting.
 type colorMetrics struct {
-	Color    color.RGBA
-	HCT      HCT
-	Vibrancy float64 // Combined chroma and tone score
-	Index    int
+	Color      color.RGBA
+	HCT        HCT
+	Vibrancy   float64 // Combined chroma and tone score
+	Proportion float64 // Share of the wallpaper, 0 when unknown
+	Weight     float64 // Vibrancy scaled by population, used for ranking
+	Index      int
 }
 
+// minPopulationWeight is the share of its vibrancy the rarest color keeps.
+// A color covering as much of the wallpaper as the most common one keeps
+// all of it, so a speck of neon loses to a vivid color that fills the image.
+const minPopulationWeight = 0.25
+
 var templateFillCmd = &cobra.Command{
 	Use:   "build",
 	Short: "build - fill the templates provided with theme data for use.",
 	Run:   BuildTemplates,
 }
 
-func init() {
-	rootCmd.AddCommand(templateFillCmd)
-}
-
-// rgbToHct converts RGB to HCT color space (Material 3's perceptual color space)
-func rgbToHct(c color.RGBA) HCT {
-	// First convert RGB to XYZ
-	r, g, b := float64(c.R)/255.0, float64(c.G)/255.0, float64(c.B)/255.0
-
-	// Gamma correction
-	if r > 0.04045 {
-		r = math.Pow((r+0.055)/1.055, 2.4)
-	} else {
-		r = r / 12.92
-	}
-	if g > 0.04045 {
-		g = math.Pow((g+0.055)/1.055, 2.4)
-	} else {
-		g = g / 12.92
-	}
-	if b > 0.04045 {
-		b = math.Pow((b+0.055)/1.055, 2.4)
-	} else {
-		b = b / 12.92
-	}
-
-	// Convert to XYZ
-	x := r*0.4124564 + g*0.3575761 + b*0.1804375
-	y := r*0.2126729 + g*0.7151522 + b*0.0721750
-	z := r*0.0193339 + g*0.1191920 + b*0.9503041
-
-	// Convert XYZ to LAB
-	xn, yn, zn := 0.95047, 1.0, 1.08883 // D65 illuminant
-	fx := labF(x / xn)
-	fy := labF(y / yn)
-	fz := labF(z / zn)
+// Theme modes accepted by build --mode.
+const (
+	modeDark  = "dark"
+	modeLight = "light"
+	modeBoth  = "both"
+)
 
-	L := 116*fy - 16
-	A := 500 * (fx - fy)
-	B := 200 * (fy - fz)
+var (
+	buildWatch    bool
+	buildMode     string
+	buildScheme   string
+	buildContrast string
+)
 
-	// Convert LAB to HCT
-	chroma := math.Sqrt(A*A + B*B)
-	hue := math.Atan2(B, A) * 180 / math.Pi
-	if hue < 0 {
-		hue += 360
-	}
+// classifyOptions are the build settings that shape classification.
+type classifyOptions struct {
+	Variant  schemeVariant
+	Contrast float64 // -1 (reduced) to 1 (high), 0 is standard
+	Seed     *HCT    // The monitor's seed override, if any
 
-	return HCT{
-		H: hue,
-		C: chroma,
-		T: L, // In HCT, Tone is equivalent to L* in LAB
-	}
+	CustomColors map[string]color.RGBA // From customcolors.json
 }
 
-func labF(t float64) float64 {
-	if t > 0.008856 {
-		return math.Pow(t, 1.0/3.0)
-	}
-	return (7.787*t + 16.0/116.0)
+func init() {
+	rootCmd.AddCommand(templateFillCmd)
+	templateFillCmd.Flags().BoolVar(&buildWatch, "watch", false,
+		"keep running and re-render templates whenever they change")
+	addBuildFlags(templateFillCmd)
 }
 
-// hctToRgb converts HCT back to RGB
-func hctToRgb(hct HCT) color.RGBA {
-	// Convert HCT to LAB
-	L := hct.T
-	A := hct.C * math.Cos(hct.H*math.Pi/180)
-	B := hct.C * math.Sin(hct.H*math.Pi/180)
-
-	// Convert LAB to XYZ
-	fy := (L + 16) / 116
-	fx := A/500 + fy
-	fz := fy - B/200
+// addBuildFlags registers the flags that control how themes are built on
+// every command that builds them.
+func addBuildFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&buildMode, "mode", modeDark,
+		"which scheme .Theme refers to: dark, light, or both (renders into dark/ and light/ subdirectories)")
+	cmd.Flags().StringVar(&buildScheme, "scheme", defaultSchemeVariant,
+		"scheme variant: "+strings.Join(schemeVariantNames(), ", "))
+	cmd.Flags().StringVar(&buildContrast, "contrast", "standard",
+		"contrast level: reduced, standard, medium, high, or a number from -1 to 1")
+	cmd.Flags().StringVar(&globalFrom, "global-from", "",
+		"build the global theme from this monitor instead of merging all monitors")
+}
 
-	var x, y, z float64
-	if fx*fx*fx > 0.008856 {
-		x = fx * fx * fx
-	} else {
-		x = (fx - 16.0/116.0) / 7.787
-	}
-	if fy*fy*fy > 0.008856 {
-		y = fy * fy * fy
-	} else {
-		y = (fy - 16.0/116.0) / 7.787
-	}
-	if fz*fz*fz > 0.008856 {
-		z = fz * fz * fz
-	} else {
-		z = (fz - 16.0/116.0) / 7.787
+// buildClassifyOptions validates the build flags and resolves them into
+// classification options.
+func buildClassifyOptions() (classifyOptions, error) {
+	switch buildMode {
+	case modeDark, modeLight, modeBoth:
+	default:
+		return classifyOptions{}, fmt.Errorf("unknown --mode %q, expected dark, light or both", buildMode)
 	}
 
-	// Scale by illuminant
-	x *= 0.95047
-	y *= 1.0
-	z *= 1.08883
-
-	// Convert XYZ to RGB
-	r := x*3.2404542 + y*-1.5371385 + z*-0.4985314
-	g := x*-0.9692660 + y*1.8760108 + z*0.0415560
-	b := x*0.0556434 + y*-0.2040259 + z*1.0572252
-
-	// Gamma correction
-	if r > 0.0031308 {
-		r = 1.055*math.Pow(r, 1/2.4) - 0.055
-	} else {
-		r = 12.92 * r
-	}
-	if g > 0.0031308 {
-		g = 1.055*math.Pow(g, 1/2.4) - 0.055
-	} else {
-		g = 12.92 * g
+	variant, err := findSchemeVariant(buildScheme)
+	if err != nil {
+		return classifyOptions{}, err
 	}
-	if b > 0.0031308 {
-		b = 1.055*math.Pow(b, 1/2.4) - 0.055
-	} else {
-		b = 12.92 * b
+	contrast, err := parseContrastLevel(buildContrast)
+	if err != nil {
+		return classifyOptions{}, err
 	}
-
-	// Clamp to [0,1] and convert to 0-255
-	r = math.Max(0, math.Min(1, r))
-	g = math.Max(0, math.Min(1, g))
-	b = math.Max(0, math.Min(1, b))
-
-	return color.RGBA{
-		R: uint8(r * 255),
-		G: uint8(g * 255),
-		B: uint8(b * 255),
-		A: 255,
+	customColors, err := loadCustomColors()
+	if err != nil {
+		return classifyOptions{}, err
 	}
+	return classifyOptions{Variant: variant, Contrast: contrast, CustomColors: customColors}, nil
 }
 
 // calculateVibrancy calculates Material 3 style vibrancy score
@@ -199,6 +247,17 @@ func calculateVibrancy(hct HCT) float64 {
 	return chromaWeight*0.7 + toneWeight*0.3
 }
 
+// populationWeightedVibrancy scales vibrancy by how common the color is
+// relative to the most common color. Palettes without populations are
+// ranked by vibrancy alone.
+func populationWeightedVibrancy(m colorMetrics, maxProportion float64) float64 {
+	if maxProportion <= 0 {
+		return m.Vibrancy
+	}
+	share := math.Sqrt(m.Proportion / maxProportion)
+	return m.Vibrancy * (minPopulationWeight + (1-minPopulationWeight)*share)
+}
+
 // calculateHueDistance calculates the shortest distance between two hues
 func calculateHueDistance(h1, h2 float64) float64 {
 	diff := math.Abs(h1 - h2)
@@ -217,57 +276,111 @@ func isHarmoniousHue(primary, secondary float64) bool {
 		(distance >= 175 && distance <= 185) // Complementary
 }
 
-// generateTonalPaletteHct creates a Material 3 compliant tonal palette using HCT
+// harmonizeHue rotates hue toward target by half their distance, at most
+// 15°, so fixed colors such as error red still sit well with the theme.
+func harmonizeHue(hue, target float64) float64 {
+	rotation := math.Min(calculateHueDistance(hue, target)*0.5, 15.0)
+	if sanitizeDegrees(target-hue) > 180 {
+		rotation = -rotation
+	}
+	return sanitizeDegrees(hue + rotation)
+}
+
+// generateTonalPaletteHct creates a Material 3 compliant tonal palette using HCT.
+// Every tone requests the seed's hue and chroma; tones where that chroma is
+// out of gamut are mapped by hctToRgb, which lowers chroma at constant hue
+// and tone instead of clipping channels.
 func generateTonalPaletteHct(seedHct HCT) TonalPalette {
 	tones := make(map[int]color.RGBA)
 
-	// Material 3 tone levels
+	// Material 3 tone levels; the rest are computed when asked for
 	toneLevels := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 100}
 
 	for _, tone := range toneLevels {
-		// Keep hue and chroma, only change tone
-		newHct := HCT{
+		tones[tone] = hctToRgb(HCT{
 			H: seedHct.H,
 			C: seedHct.C,
 			T: float64(tone),
-		}
+		})
+	}
 
-		// For very dark/light tones, reduce chroma to avoid impossible colors
-		if tone <= 20 || tone >= 90 {
-			newHct.C = seedHct.C * 0.8
-		}
-		if tone <= 10 || tone >= 95 {
-			newHct.C = seedHct.C * 0.5
-		}
+	return TonalPalette{
+		Tones:    tones,
+		KeyColor: seedHct,
+		cache:    &toneCache{tones: make(map[float64]color.RGBA)},
+	}
+}
 
-		tones[tone] = hctToRgb(newHct)
+// classifyPaletteMaterial3 analyzes a raw color palette using Material 3 principles
+// and returns dark and light schemes built from the same tonal palettes.
+func classifyPaletteMaterial3(palette []Swatch, opts classifyOptions) (dark, light ClassifiedTheme, err error) {
+	var seeds themeSeeds
+	if opts.Seed != nil {
+		// A seed set by the user replaces the wallpaper's colors
+		seeds = derivedSeeds(*opts.Seed)
+	} else if seeds, err = pickSeeds(palette); err != nil {
+		return dark, light, err
 	}
 
-	return TonalPalette{Tones: tones}
+	// Let the scheme variant decide the key colors of each role
+	keys := opts.Variant.keyColors(seeds)
+
+	// Generate tonal palettes using HCT color space
+	palettes := schemePalettes{
+		Primary:        generateTonalPaletteHct(keys.Primary),
+		Secondary:      generateTonalPaletteHct(keys.Secondary),
+		Tertiary:       generateTonalPaletteHct(keys.Tertiary),
+		Neutral:        generateTonalPaletteHct(keys.Neutral),
+		NeutralVariant: generateTonalPaletteHct(keys.NeutralVariant),
+		Error: generateTonalPaletteHct(HCT{
+			H: harmonizeHue(errorSeed.H, keys.Primary.H),
+			C: errorSeed.C,
+			T: errorSeed.T,
+		}),
+		Custom:   customPalettes(opts.CustomColors, keys.Primary.H),
+		Terminal: terminalHuePalettes(keys.Primary),
+	}
+
+	dark = assembleScheme(palettes, true)
+	light = assembleScheme(palettes, false)
+	dark.Contrast = applyContrast(&dark, opts.Contrast)
+	light.Contrast = applyContrast(&light, opts.Contrast)
+	return dark, light, nil
 }
 
-// classifyPaletteMaterial3 analyzes a raw color palette using Material 3 principles
-func classifyPaletteMaterial3(palette []color.RGBA) ClassifiedTheme {
-	if len(palette) < 4 {
-		log.Fatal("ERROR: Palette must have at least 4 colors for Material 3 generation.")
-	}
-
-	// Convert all colors to HCT and calculate metrics
-	metrics := make([]colorMetrics, len(palette))
-	for i, c := range palette {
-		hct := rgbToHct(c)
-		vibrancy := calculateVibrancy(hct)
-		metrics[i] = colorMetrics{
-			Color:    c,
-			HCT:      hct,
-			Vibrancy: vibrancy,
-			Index:    i,
+// pickSeeds picks the primary, secondary, tertiary and neutral seeds from a
+// palette. Seeds the palette is too small to provide are derived from the
+// primary.
+func pickSeeds(palette []Swatch) (themeSeeds, error) {
+	// Convert all colors to HCT and calculate metrics, skipping the
+	// transparent padding older theme files contain for flat wallpapers
+	metrics := make([]colorMetrics, 0, len(palette))
+	maxProportion := 0.0
+	for i, s := range palette {
+		if s.Color.A == 0 {
+			continue
 		}
+		hct := rgbToHct(s.Color)
+		metrics = append(metrics, colorMetrics{
+			Color:      s.Color,
+			HCT:        hct,
+			Vibrancy:   calculateVibrancy(hct),
+			Proportion: s.Proportion,
+			Index:      i,
+		})
+		maxProportion = math.Max(maxProportion, s.Proportion)
+	}
+	if len(metrics) == 0 {
+		return themeSeeds{}, errors.New("palette has no colors, cannot generate a theme")
 	}
 
-	// Sort by vibrancy (Material 3's approach)
+	// Sort by vibrancy (Material 3's approach), weighed by how much of the
+	// wallpaper each color covers
+	for i := range metrics {
+		metrics[i].Weight = populationWeightedVibrancy(metrics[i], maxProportion)
+	}
 	sort.SliceStable(metrics, func(i, j int) bool {
-		return metrics[i].Vibrancy > metrics[j].Vibrancy
+		return metrics[i].Weight > metrics[j].Weight
 	})
 
 	// Select Primary as the most vibrant color
@@ -283,13 +396,17 @@ func classifyPaletteMaterial3(palette []color.RGBA) ClassifiedTheme {
 			break
 		}
 	}
-	if !found {
+	if !found && len(metrics) > 1 {
 		// Fallback to second most vibrant if no harmonious hue found
 		secondarySeed = metrics[1]
+	} else if !found {
+		// Single color palette: use an analogous hue
+		secondarySeed = syntheticSeed(derivedSeeds(primarySeed.HCT).Secondary, -1)
 	}
 
 	// Find Tertiary that's different from both Primary and Secondary
 	var tertiarySeed colorMetrics
+	found = false
 	for i := 1; i < len(metrics); i++ {
 		if metrics[i].Index != secondarySeed.Index {
 			hue := metrics[i].HCT.H
@@ -304,8 +421,16 @@ func classifyPaletteMaterial3(palette []color.RGBA) ClassifiedTheme {
 			}
 		}
 	}
+	for i := 1; i < len(metrics) && !found; i++ {
+		// Fallback to the most vibrant color not used yet
+		if metrics[i].Index != secondarySeed.Index {
+			tertiarySeed = metrics[i]
+			found = true
+		}
+	}
 	if !found {
-		tertiarySeed = metrics[2] // Fallback
+		// Not enough colors: use a triadic hue
+		tertiarySeed = syntheticSeed(derivedSeeds(primarySeed.HCT).Tertiary, -2)
 	}
 
 	// Find a low-chroma color for Neutral
@@ -320,152 +445,445 @@ func classifyPaletteMaterial3(palette []color.RGBA) ClassifiedTheme {
 		tertiarySeed.Index:  true,
 	}
 
+	found = false
 	for _, m := range metrics {
 		if !usedIndices[m.Index] {
 			neutralSeed = m
+			found = true
 			break
 		}
 	}
+	if !found {
+		// Every color is an accent: use the primary hue at low chroma
+		neutralSeed = syntheticSeed(derivedSeeds(primarySeed.HCT).Neutral, -3)
+	}
 
-	// Generate tonal palettes using HCT color space
-	primaryPalette := generateTonalPaletteHct(primarySeed.HCT)
-	secondaryPalette := generateTonalPaletteHct(secondarySeed.HCT)
-	tertiaryPalette := generateTonalPaletteHct(tertiarySeed.HCT)
-	neutralPalette := generateTonalPaletteHct(neutralSeed.HCT)
-
-	// Assemble the final theme based on Material 3 dark theme specifications
-	return ClassifiedTheme{
-		Primary:   primaryPalette,
-		Secondary: secondaryPalette,
-		Tertiary:  tertiaryPalette,
-		Neutral:   neutralPalette,
+	return themeSeeds{
+		Primary:        primarySeed.HCT,
+		Secondary:      secondarySeed.HCT,
+		Tertiary:       tertiarySeed.HCT,
+		Neutral:        neutralSeed.HCT,
+		NeutralVariant: neutralSeed.HCT,
+	}, nil
+}
 
-		// Material 3 dark surface colors
-		Surface:          neutralPalette.Tones[6],  // Very dark neutral
-		SurfaceVariant:   neutralPalette.Tones[30], // Slightly lighter
-		OnSurface:        neutralPalette.Tones[90], // Light text on dark surface
-		OnSurfaceVariant: neutralPalette.Tones[80], // Secondary text
-		PrimaryFixed:     primaryPalette.Tones[90], // Fixed primary for consistency
-		OnPrimaryFixed:   primaryPalette.Tones[10], // Text on fixed primary
+// syntheticSeed stands in for a seed the palette has no color for. index
+// must not collide with a palette index.
+func syntheticSeed(hct HCT, index int) colorMetrics {
+	return colorMetrics{
+		Color:    hctToRgb(hct),
+		HCT:      hct,
+		Vibrancy: calculateVibrancy(hct),
+		Weight:   calculateVibrancy(hct),
+		Index:    index,
 	}
 }
 
-func BuildTemplates(cmd *cobra.Command, args []string) {
-	themeFilePath := filepath.Join(homeDir, themeFileDir)
+// derivedSeeds builds every seed from the primary alone: an analogous hue
+// for secondary, a triadic hue for tertiary and the primary hue at low
+// chroma for neutral.
+func derivedSeeds(primary HCT) themeSeeds {
+	secondary, tertiary, neutral := primary, primary, primary
+	secondary.H = sanitizeDegrees(primary.H + 30)
+	tertiary.H = sanitizeDegrees(primary.H + 120)
+	neutral.C = math.Min(primary.C, 6)
+	return themeSeeds{
+		Primary:        primary,
+		Secondary:      secondary,
+		Tertiary:       tertiary,
+		Neutral:        neutral,
+		NeutralVariant: neutral,
+	}
+}
 
-	if _, err := os.Stat(themeFilePath); err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("\nISSUE: Theme file not found.")
-			fmt.Println("FIX: Running the 'generate' command first...")
-			GenerateThemeFile(cmd, args)
-			fmt.Println("---")
-		} else {
-			fmt.Printf("\nERROR: Could not stat theme file: %v\n", err)
-			return
+// accentRoles picks the role quartet of an accent palette.
+func accentRoles(p TonalPalette, isDark bool) ColorRoles {
+	if isDark {
+		return ColorRoles{
+			Color:       p.Tone(80),
+			OnColor:     p.Tone(20),
+			Container:   p.Tone(30),
+			OnContainer: p.Tone(90),
 		}
 	}
+	return ColorRoles{
+		Color:       p.Tone(40),
+		OnColor:     p.Tone(100),
+		Container:   p.Tone(90),
+		OnContainer: p.Tone(10),
+	}
+}
 
-	data, err := os.ReadFile(themeFilePath)
-	if err != nil {
-		fmt.Printf("\nERROR: Could not read theme file: %v\n", err)
-		return
+// assembleScheme picks every role from the tonal palettes following the
+// Material 3 dark or light theme specifications.
+func assembleScheme(p schemePalettes, isDark bool) ClassifiedTheme {
+	theme := ClassifiedTheme{
+		Primary:        p.Primary,
+		Secondary:      p.Secondary,
+		Tertiary:       p.Tertiary,
+		Neutral:        p.Neutral,
+		NeutralVariant: p.NeutralVariant,
+		Error:          p.Error,
+		IsDark:         isDark,
+
+		PrimaryRoles:   accentRoles(p.Primary, isDark),
+		SecondaryRoles: accentRoles(p.Secondary, isDark),
+		TertiaryRoles:  accentRoles(p.Tertiary, isDark),
+		ErrorRoles:     accentRoles(p.Error, isDark),
+
+		Custom: make(map[string]*CustomColor, len(p.Custom)),
+
+		Scrim:  p.Neutral.Tone(0),
+		Shadow: p.Neutral.Tone(0),
+
+		PrimaryFixed:            p.Primary.Tone(90), // Fixed primary for consistency
+		PrimaryFixedDim:         p.Primary.Tone(80),
+		OnPrimaryFixed:          p.Primary.Tone(10), // Text on fixed primary
+		OnPrimaryFixedVariant:   p.Primary.Tone(30),
+		SecondaryFixed:          p.Secondary.Tone(90),
+		SecondaryFixedDim:       p.Secondary.Tone(80),
+		OnSecondaryFixed:        p.Secondary.Tone(10),
+		OnSecondaryFixedVariant: p.Secondary.Tone(30),
+		TertiaryFixed:           p.Tertiary.Tone(90),
+		TertiaryFixedDim:        p.Tertiary.Tone(80),
+		OnTertiaryFixed:         p.Tertiary.Tone(10),
+		OnTertiaryFixedVariant:  p.Tertiary.Tone(30),
+	}
+	theme.SurfaceTint = theme.PrimaryRoles.Color
+	theme.Terminal = terminalPalette(p.Neutral, p.Terminal, isDark)
+	for name, palette := range p.Custom {
+		theme.Custom[name] = &CustomColor{ColorRoles: accentRoles(palette, isDark), Palette: palette}
 	}
 
-	var allMonitorsData []MonitorInfo
-	if err = json.Unmarshal(data, &allMonitorsData); err != nil {
-		fmt.Printf("\nERROR: Could not unmarshal theme JSON: %v\n", err)
-		return
+	if isDark {
+		// Material 3 dark surface colors
+		theme.Surface = p.Neutral.Tone(6)                  // Very dark neutral
+		theme.SurfaceVariant = p.NeutralVariant.Tone(30)   // Slightly lighter
+		theme.OnSurface = p.Neutral.Tone(90)               // Light text on dark surface
+		theme.OnSurfaceVariant = p.NeutralVariant.Tone(80) // Secondary text
+
+		theme.SurfaceDim = p.Neutral.Tone(6)
+		theme.SurfaceBright = p.Neutral.Tone(24)
+		theme.SurfaceContainerLowest = p.Neutral.Tone(4)
+		theme.SurfaceContainerLow = p.Neutral.Tone(10)
+		theme.SurfaceContainer = p.Neutral.Tone(12)
+		theme.SurfaceContainerHigh = p.Neutral.Tone(17)
+		theme.SurfaceContainerHighest = p.Neutral.Tone(22)
+
+		theme.InverseSurface = p.Neutral.Tone(90)
+		theme.InverseOnSurface = p.Neutral.Tone(20)
+		theme.InversePrimary = p.Primary.Tone(40)
+
+		theme.Outline = p.NeutralVariant.Tone(60)
+		theme.OutlineVariant = p.NeutralVariant.Tone(30)
+	} else {
+		// Material 3 light surface colors
+		theme.Surface = p.Neutral.Tone(98)                 // Near-white neutral
+		theme.SurfaceVariant = p.NeutralVariant.Tone(90)   // Slightly darker
+		theme.OnSurface = p.Neutral.Tone(10)               // Dark text on light surface
+		theme.OnSurfaceVariant = p.NeutralVariant.Tone(30) // Secondary text
+
+		theme.SurfaceDim = p.Neutral.Tone(87)
+		theme.SurfaceBright = p.Neutral.Tone(98)
+		theme.SurfaceContainerLowest = p.Neutral.Tone(100)
+		theme.SurfaceContainerLow = p.Neutral.Tone(96)
+		theme.SurfaceContainer = p.Neutral.Tone(94)
+		theme.SurfaceContainerHigh = p.Neutral.Tone(92)
+		theme.SurfaceContainerHighest = p.Neutral.Tone(90)
+
+		theme.InverseSurface = p.Neutral.Tone(20)
+		theme.InverseOnSurface = p.Neutral.Tone(95)
+		theme.InversePrimary = p.Primary.Tone(80)
+
+		theme.Outline = p.NeutralVariant.Tone(50)
+		theme.OutlineVariant = p.NeutralVariant.Tone(80)
 	}
+	theme.Background = theme.Surface
+	theme.OnBackground = theme.OnSurface
+	return theme
+}
 
-	appDir := filepath.Join(homeDir, tm0dDir)
-	templatesDir := filepath.Join(appDir, "Templates")
-	themesOutputDir := filepath.Join(appDir, "Themes")
+// TemplateData is the value every template is executed with.
+type TemplateData struct {
+	Monitor string
+	Mode    string          // "dark" or "light", matching Theme
+	Theme   ClassifiedTheme // The scheme selected with build --mode
+	Dark    ClassifiedTheme
+	Light   ClassifiedTheme
+}
 
-	templateFiles, err := os.ReadDir(templatesDir)
+// renderTarget is an output directory and the data rendered into it.
+type renderTarget struct {
+	Dir  string
+	Data TemplateData
+}
+
+var templateFuncs = template.FuncMap{
+	"toHex": func(c color.RGBA) string {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	},
+	"toRgba": func(c color.RGBA, alpha string) string {
+		return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.R, c.G, c.B, alpha)
+	},
+	// Helper to easily access any tone from a palette in the template.
+	// The level may be any number, including ints held in variables.
+	"tone": func(p TonalPalette, level any) (color.RGBA, error) {
+		tone, err := toneLevel(level)
+		if err != nil {
+			return color.RGBA{}, err
+		}
+		if tone < 0 || tone > 100 {
+			// Return a bright pink for debugging if a tone is out of range.
+			return color.RGBA{R: 255, G: 0, B: 255, A: 255}, nil
+		}
+		return p.Tone(tone), nil
+	},
+}
+
+// toneLevel converts a tone passed to the tone template function to a
+// float64. Templates hand over literals as int or float64, but variables
+// and data can hold any numeric kind.
+func toneLevel(level any) (float64, error) {
+	v := reflect.ValueOf(level)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	default:
+		return 0, fmt.Errorf("tone level must be a number, got %T", level)
+	}
+}
+
+// renderTemplate executes a single template file into outputDir.
+func renderTemplate(templatesDir, templateName, outputDir string, data TemplateData) error {
+	finalFileName := strings.TrimSuffix(templateName, ".tmpl")
+	templatePath := filepath.Join(templatesDir, templateName)
+	outputPath := filepath.Join(outputDir, finalFileName)
+
+	templateContent, err := os.ReadFile(templatePath)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to read templates directory '%s': %v\n", templatesDir, err)
-		return
+		return fmt.Errorf("failed to read template file %s: %w", templateName, err)
 	}
 
-	fmt.Printf("Preparing output directory: %s\n", themesOutputDir)
-	_ = os.RemoveAll(themesOutputDir)
-	if err := os.MkdirAll(themesOutputDir, 0755); err != nil {
-		fmt.Printf("ERROR: Could not create output directory: %v\n", err)
-		return
+	tmpl, err := template.New(templateName).Funcs(templateFuncs).Parse(string(templateContent))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", templateName, err)
 	}
 
-	funcMap := template.FuncMap{
-		"toHex": func(c color.RGBA) string {
-			return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
-		},
-		"toRgba": func(c color.RGBA, alpha string) string {
-			return fmt.Sprintf("rgba(%d, %d, %d, %s)", c.R, c.G, c.B, alpha)
-		},
-		// Helper to easily access a tone from a palette in the template.
-		"tone": func(p TonalPalette, level int) color.RGBA {
-			if c, ok := p.Tones[level]; ok {
-				return c
-			}
-			// Return a bright pink for debugging if a tone is missing.
-			return color.RGBA{R: 255, G: 0, B: 255, A: 255}
-		},
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
 	}
+	defer outputFile.Close()
 
-	for _, monitorData := range allMonitorsData {
-		monitorOutputDir := filepath.Join(themesOutputDir, monitorData.Monitor)
-		if err := os.MkdirAll(monitorOutputDir, 0755); err != nil {
-			log.Printf("ERROR: Could not create directory for monitor %s: %v", monitorData.Monitor, err)
-			continue
+	if err := tmpl.Execute(outputFile, data); err != nil {
+		return fmt.Errorf("failed to execute template %s: %w", templateName, err)
+	}
+	return nil
+}
+
+// newTemplateData classifies a monitor's palette into the data templates see,
+// with Theme set to the scheme for mode.
+func newTemplateData(monitorData MonitorInfo, mode string, opts classifyOptions) (TemplateData, error) {
+	if monitorData.Theme.Seed != "" {
+		seed, err := parseHexColor(monitorData.Theme.Seed)
+		if err != nil {
+			return TemplateData{}, fmt.Errorf("invalid seed for %s: %w", monitorData.Monitor, err)
 		}
-		fmt.Printf("\nProcessing templates for monitor: %s\n", monitorData.Monitor)
+		seedHct := rgbToHct(seed)
+		opts.Seed = &seedHct
+	}
 
-		// Use Material 3 classification instead of simple saturation sorting
-		classifiedTheme := classifyPaletteMaterial3(monitorData.Theme.Palletes)
+	// Use Material 3 classification instead of simple saturation sorting
+	dark, light, err := classifyPaletteMaterial3(monitorData.Theme.colorSwatches(), opts)
+	if err != nil {
+		return TemplateData{}, fmt.Errorf("could not classify palette of %s: %w", monitorData.Monitor, err)
+	}
 
-		templateData := struct {
-			Monitor string
-			Theme   ClassifiedTheme
-		}{
-			Monitor: monitorData.Monitor,
-			Theme:   classifiedTheme,
+	data := TemplateData{
+		Monitor: monitorData.Monitor,
+		Mode:    mode,
+		Theme:   dark,
+		Dark:    dark,
+		Light:   light,
+	}
+	if mode == modeLight {
+		data.Theme = light
+	}
+	return data, nil
+}
+
+// monitorRenderTargets returns where a monitor's templates are rendered for
+// the current --mode: Themes/<monitor>/, or its dark/ and light/
+// subdirectories when building both.
+func monitorRenderTargets(monitorData MonitorInfo, opts classifyOptions) ([]renderTarget, error) {
+	monitorOutputDir := monitorThemeDir(monitorData.Monitor)
+	if buildMode != modeBoth {
+		data, err := newTemplateData(monitorData, buildMode, opts)
+		if err != nil {
+			return nil, err
 		}
+		return []renderTarget{{Dir: monitorOutputDir, Data: data}}, nil
+	}
 
-		for _, file := range templateFiles {
-			if file.IsDir() {
-				continue
-			}
+	dark, err := newTemplateData(monitorData, modeDark, opts)
+	if err != nil {
+		return nil, err
+	}
+	light, err := newTemplateData(monitorData, modeLight, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []renderTarget{
+		{Dir: filepath.Join(monitorOutputDir, modeDark), Data: dark},
+		{Dir: filepath.Join(monitorOutputDir, modeLight), Data: light},
+	}, nil
+}
 
-			templateName := file.Name()
-			finalFileName := strings.TrimSuffix(templateName, ".tmpl")
-			templatePath := filepath.Join(templatesDir, templateName)
-			outputPath := filepath.Join(monitorOutputDir, finalFileName)
+// buildMonitorThemes renders every per-monitor template for the given monitors into
+// Themes/<monitor>/. Monitors not in the list are left untouched. Monitors
+// that share a theme are classified once; unless a template uses .Monitor,
+// only the first is rendered and the others link to its directory.
+func buildMonitorThemes(monitors []MonitorInfo, opts classifyOptions) error {
+	templatesDir := filepath.Join(homeDir, tm0dDir, "Templates")
 
-			fmt.Printf("  -> Rendering %s\n", templateName)
+	allTemplates, err := listTemplates(templatesDir)
+	if err != nil {
+		return err
+	}
+	templateNames, _ := splitTemplateScopes(templatesDir, allTemplates)
+	perMonitor := templatesReferenceMonitor(templatesDir, templateNames)
 
-			templateContent, err := os.ReadFile(templatePath)
-			if err != nil {
-				log.Printf("ERROR: Failed to read template file %s: %v", templateName, err)
-				continue
-			}
+	for _, group := range monitorGroups(monitors) {
+		leader := group[0]
+		fmt.Printf("\nProcessing templates for monitor: %s\n", leader.Monitor)
 
-			tmpl, err := template.New(templateName).Funcs(funcMap).Parse(string(templateContent))
-			if err != nil {
-				log.Printf("ERROR: Failed to parse template %s: %v", templateName, err)
+		targets, err := monitorRenderTargets(leader, opts)
+		if err != nil {
+			log.Printf("ERROR: %v. Skipping.", err)
+			continue
+		}
+		renderMonitorTargets(templatesDir, templateNames, leader.Monitor, targets, opts)
+
+		for _, follower := range group[1:] {
+			if !perMonitor {
+				fmt.Printf("\nMonitor %s shows the same theme, linking it to %s\n", follower.Monitor, leader.Monitor)
+				if err := linkMonitorTheme(follower.Monitor, leader.Monitor); err != nil {
+					log.Printf("ERROR: %v", err)
+				}
 				continue
 			}
+			fmt.Printf("\nProcessing templates for monitor: %s (same theme as %s)\n", follower.Monitor, leader.Monitor)
+			renderMonitorTargets(templatesDir, templateNames, follower.Monitor,
+				retargetMonitor(targets, leader.Monitor, follower.Monitor), opts)
+		}
+	}
+	return nil
+}
 
-			outputFile, err := os.Create(outputPath)
-			if err != nil {
-				log.Printf("ERROR: Failed to create output file %s: %v", outputPath, err)
-				continue
-			}
+// listTemplates returns the names of the files in the templates directory.
+func listTemplates(templatesDir string) ([]string, error) {
+	templateFiles, err := os.ReadDir(templatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory '%s': %w", templatesDir, err)
+	}
+	var names []string
+	for _, file := range templateFiles {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// renderMonitorTargets renders every template into each of a monitor's
+// targets and reports the contrast of each.
+func renderMonitorTargets(templatesDir string, templateNames []string, monitor string, targets []renderTarget, opts classifyOptions) {
+	if err := unlinkMonitorTheme(monitor); err != nil {
+		log.Printf("ERROR: Could not unlink theme directory of %s: %v", monitor, err)
+		return
+	}
 
-			err = tmpl.Execute(outputFile, templateData)
-			if err != nil {
-				log.Printf("ERROR: Failed to execute template %s: %v", templateName, err)
+	for _, target := range targets {
+		if err := os.MkdirAll(target.Dir, 0755); err != nil {
+			log.Printf("ERROR: Could not create directory for monitor %s: %v", monitor, err)
+			continue
+		}
+
+		for _, name := range templateNames {
+			fmt.Printf("  -> Rendering %s (%s)\n", name, target.Data.Mode)
+			if err := renderTemplate(templatesDir, name, target.Dir, target.Data); err != nil {
+				log.Printf("ERROR: %v", err)
 			}
-			outputFile.Close()
 		}
+		printContrastReport(target.Data.Mode, opts.Contrast, target.Data.Theme.Contrast)
+	}
+}
+
+// printContrastReport lists the contrast ratio every role pair achieved.
+func printContrastReport(mode string, level float64, results []ContrastResult) {
+	fmt.Printf("  Contrast (%s, %s):\n", mode, contrastLevelName(level))
+	width := 0
+	for _, r := range results {
+		width = max(width, len(r.Pair))
+	}
+	for _, r := range results {
+		status := "ok"
+		if !r.Met() {
+			status = "below target"
+		}
+		fmt.Printf("     %-*s %6.2f:1  (target %.2f:1) %s\n", width, r.Pair, r.Ratio, r.Target, status)
+	}
+}
+
+func BuildTemplates(cmd *cobra.Command, args []string) {
+	opts, err := buildClassifyOptions()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	themeFilePath := filepath.Join(homeDir, themeFileDir)
+
+	if _, err := os.Stat(themeFilePath); err != nil {
+		if os.IsNotExist(err) {
+			fmt.Println("\nISSUE: Theme file not found.")
+			fmt.Println("FIX: Running the 'generate' command first...")
+			GenerateThemeFile(cmd, args)
+			fmt.Println("---")
+		} else {
+			fmt.Printf("\nERROR: Could not stat theme file: %v\n", err)
+			return
+		}
+	}
+
+	allMonitorsData, err := loadThemeFile()
+	if err != nil {
+		fmt.Printf("\nERROR: %v\n", err)
+		return
+	}
+
+	themesOutputDir := filepath.Join(homeDir, tm0dDir, "Themes")
+	fmt.Printf("Preparing output directory: %s\n", themesOutputDir)
+	_ = os.RemoveAll(themesOutputDir)
+	if err := os.MkdirAll(themesOutputDir, 0755); err != nil {
+		fmt.Printf("ERROR: Could not create output directory: %v\n", err)
+		return
+	}
+
+	if err := buildMonitorThemes(allMonitorsData, opts); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if err := buildGlobalTheme(allMonitorsData, opts); err != nil {
+		fmt.Printf("ERROR: Could not build the global theme: %v\n", err)
 	}
 	fmt.Println("\nBuild complete!")
+
+	if buildWatch {
+		watchTemplates(opts)
+	}
 }
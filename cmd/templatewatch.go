@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// templateDebounce absorbs the burst of events editors emit for one save.
+const templateDebounce = 150 * time.Millisecond
+
+// watchTemplates re-renders templates as they change until interrupted.
+// Errors are printed and the watcher keeps running.
+func watchTemplates(opts classifyOptions) {
+	templatesDir := filepath.Join(homeDir, tm0dDir, "Templates")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("ERROR: Could not start template watcher: %v\n", err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(templatesDir); err != nil {
+		fmt.Printf("ERROR: Could not watch '%s': %v\n", templatesDir, err)
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	pending := make(map[string]fsnotify.Op)
+	debounce := time.NewTimer(0)
+	<-debounce.C
+
+	fmt.Printf("\nWatching %s for changes, press Ctrl+C to stop...\n", templatesDir)
+	for {
+		select {
+		case <-interrupt:
+			fmt.Println("\nStopped watching.")
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(event.Name)
+			if isEditorTempFile(name) {
+				continue
+			}
+			pending[name] |= event.Op
+			debounce.Reset(templateDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("ERROR: Template watcher: %v", err)
+		case <-debounce.C:
+			for name, op := range pending {
+				rebuildTemplate(templatesDir, name, op, opts)
+			}
+			clear(pending)
+		}
+	}
+}
+
+// rebuildTemplate re-renders one template for every monitor in the theme
+// file and for the global theme, as its scope asks, or removes its outputs
+// when the template is gone.
+func rebuildTemplate(templatesDir, templateName string, op fsnotify.Op, opts classifyOptions) {
+	monitors, err := loadThemeFile()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	info, statErr := os.Stat(filepath.Join(templatesDir, templateName))
+	if statErr != nil && op.Has(fsnotify.Remove|fsnotify.Rename) {
+		fmt.Printf("[%s] %s removed\n", time.Now().Format(time.TimeOnly), templateName)
+		removeMonitorOutputs(monitors, templateName, opts)
+		removeGlobalOutput(templateName)
+		return
+	}
+	if statErr != nil || info.IsDir() {
+		return
+	}
+
+	fmt.Printf("[%s] %s changed\n", time.Now().Format(time.TimeOnly), templateName)
+	scope, err := templateScope(templatesDir, templateName)
+	if err != nil {
+		fmt.Printf("  !! %v\n", err)
+	}
+
+	// A template whose scope changed leaves no outputs behind
+	if scope == scopeGlobal {
+		removeMonitorOutputs(monitors, templateName, opts)
+	} else {
+		rebuildMonitorTemplate(templatesDir, templateName, monitors, opts)
+	}
+	if scope == scopeMonitor {
+		removeGlobalOutput(templateName)
+	} else {
+		rebuildGlobalTemplate(templatesDir, templateName, monitors, opts)
+	}
+}
+
+// rebuildMonitorTemplate renders one template for every monitor. Monitors
+// whose theme directory links to another monitor's are covered by that
+// monitor.
+func rebuildMonitorTemplate(templatesDir, templateName string, monitors []MonitorInfo, opts classifyOptions) {
+	perMonitor := templateReferencesMonitor(templatesDir, templateName)
+	for _, group := range monitorGroups(monitors) {
+		leader := group[0]
+		leaderTargets, err := monitorRenderTargets(leader, opts)
+		if err != nil {
+			fmt.Printf("  !! %s: %v\n", leader.Monitor, err)
+			continue
+		}
+
+		for _, monitorData := range group {
+			targets := retargetMonitor(leaderTargets, leader.Monitor, monitorData.Monitor)
+			if monitorData.Monitor != leader.Monitor && themeLinkTarget(monitorData.Monitor) != "" {
+				if !perMonitor {
+					continue
+				}
+				// The template now depends on the monitor, so the linked
+				// monitor needs a directory of its own with every template.
+				allTemplates, err := listTemplates(templatesDir)
+				if err != nil {
+					fmt.Printf("  !! %s: %v\n", monitorData.Monitor, err)
+					continue
+				}
+				templateNames, _ := splitTemplateScopes(templatesDir, allTemplates)
+				fmt.Printf("  -> Giving %s its own theme directory\n", monitorData.Monitor)
+				renderMonitorTargets(templatesDir, templateNames, monitorData.Monitor, targets, opts)
+				continue
+			}
+			renderTemplateTargets(templatesDir, templateName, monitorData.Monitor, targets)
+		}
+	}
+}
+
+// rebuildGlobalTemplate renders one template for the global theme.
+func rebuildGlobalTemplate(templatesDir, templateName string, monitors []MonitorInfo, opts classifyOptions) {
+	info, err := globalMonitorInfo(monitors)
+	if err != nil {
+		fmt.Printf("  !! %s: %v\n", globalThemeName, err)
+		return
+	}
+	targets, err := monitorRenderTargets(info, opts)
+	if err != nil {
+		fmt.Printf("  !! %s: %v\n", globalThemeName, err)
+		return
+	}
+	renderTemplateTargets(templatesDir, templateName, globalThemeName, targets)
+}
+
+// renderTemplateTargets renders one template into each of a monitor's
+// targets.
+func renderTemplateTargets(templatesDir, templateName, monitor string, targets []renderTarget) {
+	for _, target := range targets {
+		if err := os.MkdirAll(target.Dir, 0755); err != nil {
+			fmt.Printf("  !! %s: could not create output directory: %v\n", monitor, err)
+			continue
+		}
+
+		if err := renderTemplate(templatesDir, templateName, target.Dir, target.Data); err != nil {
+			fmt.Printf("  !! %s (%s): %v\n", monitor, target.Data.Mode, err)
+			continue
+		}
+		fmt.Printf("  -> Rendered for %s (%s)\n", monitor, target.Data.Mode)
+	}
+}
+
+// removeMonitorOutputs deletes what a template rendered for every monitor.
+func removeMonitorOutputs(monitors []MonitorInfo, templateName string, opts classifyOptions) {
+	for _, monitorData := range monitors {
+		if themeLinkTarget(monitorData.Monitor) != "" {
+			continue
+		}
+		targets, err := monitorRenderTargets(monitorData, opts)
+		if err != nil {
+			fmt.Printf("  !! %s: %v\n", monitorData.Monitor, err)
+			continue
+		}
+		for _, target := range targets {
+			_ = os.Remove(filepath.Join(target.Dir, strings.TrimSuffix(templateName, ".tmpl")))
+		}
+	}
+}
+
+// removeGlobalOutput deletes what a template rendered for the global theme
+// in any mode.
+func removeGlobalOutput(templateName string) {
+	output := strings.TrimSuffix(templateName, ".tmpl")
+	for _, dir := range []string{"", modeDark, modeLight} {
+		_ = os.Remove(filepath.Join(monitorThemeDir(globalThemeName), dir, output))
+	}
+}
+
+// isEditorTempFile skips swap, backup and hidden files editors write
+// alongside the real template.
+func isEditorTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, ".swx") ||
+		name == "4913"
+}
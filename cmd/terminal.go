@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"image/color"
+	"math"
+)
+
+// terminalBrightStep is how many tones a bright ANSI color is away from its
+// normal color: lighter in a dark scheme, darker in a light one.
+const terminalBrightStep = 10.0
+
+// ansiHues are the HCT hues of pure red, green, yellow, blue, magenta and
+// cyan, the positions the terminal colors are anchored to.
+var ansiHues = [6]float64{27, 142, 111, 282, 334, 196}
+
+// TerminalPalette is the 16-color ANSI palette, color0 to color15.
+type TerminalPalette struct {
+	Black, Red, Green, Yellow, Blue, Magenta, Cyan, White color.RGBA
+
+	BrightBlack, BrightRed, BrightGreen, BrightYellow  color.RGBA
+	BrightBlue, BrightMagenta, BrightCyan, BrightWhite color.RGBA
+
+	// palettes the colors are picked from, in ANSI order; black and white
+	// come from the theme's neutral palette
+	palettes [8]TonalPalette
+}
+
+// Colors returns color0 to color15 in order.
+func (t TerminalPalette) Colors() []color.RGBA {
+	return []color.RGBA{
+		t.Black, t.Red, t.Green, t.Yellow, t.Blue, t.Magenta, t.Cyan, t.White,
+		t.BrightBlack, t.BrightRed, t.BrightGreen, t.BrightYellow,
+		t.BrightBlue, t.BrightMagenta, t.BrightCyan, t.BrightWhite,
+	}
+}
+
+// terminalHuePalettes builds palettes for the six ANSI hues. Hues are
+// harmonized toward the primary so they are tinted by the theme, and
+// chroma follows the primary within limits so red and green stay
+// recognizable on gray wallpapers.
+func terminalHuePalettes(primary HCT) [6]TonalPalette {
+	chroma := math.Min(math.Max(primary.C, 36), 72)
+
+	var palettes [6]TonalPalette
+	for i, hue := range ansiHues {
+		palettes[i] = generateTonalPaletteHct(HCT{
+			H: harmonizeHue(hue, primary.H),
+			C: chroma,
+			T: 50,
+		})
+	}
+	return palettes
+}
+
+// terminalPalette picks the ANSI colors for a dark or light scheme. The
+// contrast against Surface is enforced later with the other role pairs.
+func terminalPalette(neutral TonalPalette, hues [6]TonalPalette, isDark bool) TerminalPalette {
+	t := TerminalPalette{palettes: [8]TonalPalette{
+		neutral, hues[0], hues[1], hues[2], hues[3], hues[4], hues[5], neutral,
+	}}
+
+	normalTone, brightTone := 40.0, 40.0-terminalBrightStep
+	black, brightBlack, white, brightWhite := 10.0, 40.0, 90.0, 98.0
+	if isDark {
+		normalTone, brightTone = 70, 70+terminalBrightStep
+		black, brightBlack, white, brightWhite = 20, 50, 80, 95
+	}
+
+	normal := []*color.RGBA{&t.Red, &t.Green, &t.Yellow, &t.Blue, &t.Magenta, &t.Cyan}
+	bright := []*color.RGBA{&t.BrightRed, &t.BrightGreen, &t.BrightYellow, &t.BrightBlue, &t.BrightMagenta, &t.BrightCyan}
+	for i := range hues {
+		*normal[i] = hues[i].Tone(normalTone)
+		*bright[i] = hues[i].Tone(brightTone)
+	}
+
+	t.Black = neutral.Tone(black)
+	t.BrightBlack = neutral.Tone(brightBlack)
+	t.White = neutral.Tone(white)
+	t.BrightWhite = neutral.Tone(brightWhite)
+	return t
+}
+
+// terminalContrastPairs are the ANSI colors used on Surface. That excludes
+// black in a dark scheme, and both whites in a light one. Bright black is
+// mostly used for dimmed text such as comments and only needs the contrast
+// of a UI component.
+func terminalContrastPairs(t *ClassifiedTheme) []contrastPair {
+	term := &t.Terminal
+	names := []string{"Black", "Red", "Green", "Yellow", "Blue", "Magenta", "Cyan", "White"}
+	normal := []*color.RGBA{&term.Black, &term.Red, &term.Green, &term.Yellow, &term.Blue, &term.Magenta, &term.Cyan, &term.White}
+	bright := []*color.RGBA{&term.BrightBlack, &term.BrightRed, &term.BrightGreen, &term.BrightYellow,
+		&term.BrightBlue, &term.BrightMagenta, &term.BrightCyan, &term.BrightWhite}
+
+	var pairs []contrastPair
+	for i, name := range names {
+		if !(t.IsDark && name == "Black") && !(!t.IsDark && name == "White") {
+			pairs = append(pairs, contrastPair{"Terminal." + name + "/Surface", normal[i], term.palettes[i], &t.Surface, t.Neutral, textContrast, false})
+		}
+		if t.IsDark || name != "White" {
+			curve := textContrast
+			if name == "Black" {
+				curve = componentContrast
+			}
+			pairs = append(pairs, contrastPair{"Terminal.Bright" + name + "/Surface", bright[i], term.palettes[i], &t.Surface, t.Neutral, curve, false})
+		}
+	}
+	return pairs
+}
+
+// separateTerminalBrights keeps every bright color terminalBrightStep tones
+// past its normal color, on the side away from Surface. Meeting the contrast
+// target can move both to the same tone, which would make them identical.
+// Moving away from Surface only adds contrast. White is only separated in a
+// dark scheme, where both whites are text.
+func separateTerminalBrights(t *ClassifiedTheme) {
+	term := &t.Terminal
+	normal := []*color.RGBA{&term.Red, &term.Green, &term.Yellow, &term.Blue, &term.Magenta, &term.Cyan, &term.White}
+	bright := []*color.RGBA{&term.BrightRed, &term.BrightGreen, &term.BrightYellow, &term.BrightBlue,
+		&term.BrightMagenta, &term.BrightCyan, &term.BrightWhite}
+
+	for i := range normal {
+		if i == len(normal)-1 && !t.IsDark {
+			break
+		}
+		palette := term.palettes[i+1]
+		normalTone, brightTone := toneOf(*normal[i]), toneOf(*bright[i])
+		if t.IsDark {
+			if want := math.Min(normalTone+terminalBrightStep, 100); brightTone < want {
+				*bright[i] = palette.Tone(want)
+			}
+		} else if want := math.Max(normalTone-terminalBrightStep, 0); brightTone > want {
+			*bright[i] = palette.Tone(want)
+		}
+	}
+}
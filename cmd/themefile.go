@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// themeFileVersion is the schema version of the theme files this build
+// writes, described by schema/tm0d.schema.json. Version 1 is the bare
+// array of monitors written before the file was versioned.
+const themeFileVersion = 2
+
+// ThemeFile is the document saved as currenttheme.tm0d.
+type ThemeFile struct {
+	Version   int              `json:"version"`
+	Generator string           `json:"generator"` // archThemeM0d version that wrote the file
+	Generated time.Time        `json:"generated"`
+	Settings  GenerateSettings `json:"settings"`
+	Monitors  []MonitorInfo    `json:"monitors"`
+}
+
+// GenerateSettings are the options the palettes were extracted with.
+type GenerateSettings struct {
+	Source      string `json:"source"` // Wallpaper daemon that was used, or "image" for --image
+	Quantizer   string `json:"quantizer"`
+	Colors      int    `json:"colors"`       // Colors requested per wallpaper
+	PixelBudget int    `json:"pixel_budget"` // --pixel-budget, 0 for full resolution
+}
+
+// legacyMonitorInfo is a monitor entry of a version 1 theme file, which
+// stored the colors under the misspelled "palletes" key.
+type legacyMonitorInfo struct {
+	Monitor string `json:"monitor"`
+	Theme   struct {
+		WallpaperPath string       `json:"wallpaper_location"`
+		Palletes      []color.RGBA `json:"palletes"`
+		Swatches      []Swatch     `json:"swatches"`
+		Seed          string       `json:"seed"`
+	} `json:"theme"`
+}
+
+// imageSourceName is the source recorded for wallpapers given with --image.
+const imageSourceName = "image"
+
+// currentGenerateSettings describes the extraction flags in effect, with
+// source being the daemon the wallpapers actually came from rather than
+// the --source flag, which may be "auto".
+func currentGenerateSettings(source string) GenerateSettings {
+	return GenerateSettings{
+		Source:      source,
+		Quantizer:   quantizerName,
+		Colors:      paletteSize,
+		PixelBudget: pixelBudget,
+	}
+}
+
+// loadThemeFile reads the monitor palettes written by the generate command.
+func loadThemeFile() ([]MonitorInfo, error) {
+	file, err := readThemeFile(filepath.Join(homeDir, themeFileDir))
+	if err != nil {
+		return nil, err
+	}
+	return file.Monitors, nil
+}
+
+// readThemeFile reads a theme file of any version, upgrading older ones
+// to the current schema in memory.
+func readThemeFile(path string) (ThemeFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ThemeFile{}, fmt.Errorf("could not read theme file: %w", err)
+	}
+
+	file, err := parseThemeFile(data)
+	if err != nil {
+		return ThemeFile{}, fmt.Errorf("could not parse theme file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+func parseThemeFile(data []byte) (ThemeFile, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return migrateLegacyThemeFile(data)
+	}
+
+	var file ThemeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return ThemeFile{}, err
+	}
+	switch {
+	case file.Version > themeFileVersion:
+		return ThemeFile{}, fmt.Errorf("version %d was written by a newer archThemeM0d (this one reads up to %d)", file.Version, themeFileVersion)
+	case file.Version < 2:
+		return ThemeFile{}, fmt.Errorf("missing or unknown version %d", file.Version)
+	}
+	return file, nil
+}
+
+// migrateLegacyThemeFile upgrades a version 1 theme file. The settings and
+// time it was generated with were never recorded, so they stay empty.
+func migrateLegacyThemeFile(data []byte) (ThemeFile, error) {
+	var legacy []legacyMonitorInfo
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return ThemeFile{}, err
+	}
+
+	file := ThemeFile{Version: themeFileVersion, Monitors: make([]MonitorInfo, 0, len(legacy))}
+	for _, m := range legacy {
+		file.Monitors = append(file.Monitors, MonitorInfo{
+			Monitor: m.Monitor,
+			Theme: WallpaperInfo{
+				WallpaperPath: m.Theme.WallpaperPath,
+				Colors:        m.Theme.Palletes,
+				Swatches:      m.Theme.Swatches,
+				Seed:          m.Theme.Seed,
+			},
+		})
+	}
+	return file, nil
+}
+
+// writeThemeFile saves the monitor palettes to currenttheme.tm0d, creating
+// the ThemeM0d directory if needed, and records them in the history. source
+// names where the wallpapers came from. It returns the file's path and its
+// history id.
+func writeThemeFile(monitors []MonitorInfo, source string) (string, string, error) {
+	themeDir := filepath.Join(homeDir, tm0dDir)
+	if exists, err := DoesThemeM0dFolderExist(); err != nil {
+		return "", "", fmt.Errorf("could not check ThemeM0d folder: %w", err)
+	} else if !exists {
+		if err := os.MkdirAll(themeDir, 0755); err != nil {
+			return "", "", fmt.Errorf("an eror occured trying to make ThemeM0d Directory: %w", err)
+		}
+	}
+
+	// Monitors are sorted so the same theme always has the same content
+	sorted := append([]MonitorInfo(nil), monitors...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Monitor < sorted[j].Monitor
+	})
+	file := ThemeFile{
+		Version:   themeFileVersion,
+		Generator: Version,
+		Generated: time.Now().UTC().Truncate(time.Second),
+		Settings:  currentGenerateSettings(source),
+		Monitors:  sorted,
+	}
+	jsonData, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate JSON: %w", err)
+	}
+
+	outputFile := filepath.Join(homeDir, themeFileDir)
+	if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write theme file: %w", err)
+	}
+
+	id, err := recordHistory(file, jsonData)
+	if err != nil {
+		log.Printf("WARNING: Could not save the theme to history: %v", err)
+	}
+	return outputFile, id, nil
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WallpaperSource is a wallpaper daemon that can report which image each
+// monitor is currently displaying.
+type WallpaperSource interface {
+	// Name is the value used to select the source with --source.
+	Name() string
+	// Running reports whether the daemon is active in this session.
+	Running() bool
+	// Wallpapers returns a map of monitor name to wallpaper path.
+	Wallpapers() (map[string]string, error)
+}
+
+// allOutputsMonitor is used as the monitor name when a daemon applies one
+// wallpaper to every output without naming them.
+const allOutputsMonitor = "all"
+
+// wallpaperSources lists the supported daemons in auto-detection order.
+var wallpaperSources = []WallpaperSource{
+	hyprpaperSource{},
+	swwwSource{},
+	wpaperdSource{},
+	swaybgSource{},
+	mpvpaperSource{},
+}
+
+var wallpaperSourceName string
+
+// resolveWallpaperSource returns the source with the given name, or the first
+// running one when name is "auto".
+func resolveWallpaperSource(name string) (WallpaperSource, error) {
+	if name == "" || name == "auto" {
+		for _, source := range wallpaperSources {
+			if source.Running() {
+				return source, nil
+			}
+		}
+		return nil, fmt.Errorf("no supported wallpaper daemon is running (tried %s)", strings.Join(wallpaperSourceNames(), ", "))
+	}
+
+	for _, source := range wallpaperSources {
+		if source.Name() == name {
+			return source, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown wallpaper source %q (valid: auto, %s)", name, strings.Join(wallpaperSourceNames(), ", "))
+}
+
+func wallpaperSourceNames() []string {
+	names := make([]string, 0, len(wallpaperSources))
+	for _, source := range wallpaperSources {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+// parseMonitorLines parses "monitor<sep>path" lines as printed by most
+// wallpaper daemons' query commands.
+func parseMonitorLines(output, sep string) map[string]string {
+	wallpapers := make(map[string]string)
+	lines := strings.Split(output, "\n")
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		monitorName := strings.TrimSpace(parts[0])
+		wallpaperPath := strings.TrimSpace(parts[1])
+		if monitorName == "" || wallpaperPath == "" {
+			continue
+		}
+
+		wallpapers[monitorName] = wallpaperPath
+	}
+
+	return wallpapers
+}
+
+// findProcessArgs returns the command lines of every running process whose
+// executable name matches name.
+func findProcessArgs(name string) [][]string {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var found [][]string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		found = append(found, args)
+	}
+	return found
+}
+
+func isProcessRunning(name string) bool {
+	return len(findProcessArgs(name)) > 0
+}
+
+// expandHome resolves a leading "~" the way the daemons' configs allow.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir, path[2:])
+	}
+	return path
+}
+
+// hyprpaperSource asks hyprpaper over its IPC socket.
+type hyprpaperSource struct{}
+
+func (hyprpaperSource) Name() string { return "hyprpaper" }
+
+func (hyprpaperSource) Running() bool {
+	client, err := NewHyprpaperClient()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(client.SocketPath)
+	return err == nil
+}
+
+func (hyprpaperSource) Wallpapers() (map[string]string, error) {
+	client, err := NewHyprpaperClient()
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := client.ActiveWallpapers()
+	if err != nil {
+		return nil, err
+	}
+
+	wallpapers := make(map[string]string)
+	var wildcard string
+	for _, wallpaper := range active {
+		if wallpaper.Monitor == "" {
+			wildcard = wallpaper.Path
+			continue
+		}
+		wallpapers[wallpaper.Monitor] = wallpaper.Path
+	}
+
+	// A wildcard wallpaper covers every monitor without its own entry.
+	if wildcard != "" {
+		hyprland, err := NewHyprlandClient()
+		if err != nil {
+			return nil, err
+		}
+		monitors, err := hyprland.Monitors()
+		if err != nil {
+			return nil, err
+		}
+		for _, monitor := range monitors {
+			if _, ok := wallpapers[monitor.Name]; !ok {
+				wallpapers[monitor.Name] = wildcard
+			}
+		}
+	}
+
+	return wallpapers, nil
+}
+
+// swwwSource parses `swww query`, which prints lines such as
+// "DP-1: 2560x1440, scale: 1, currently displaying: image: /path/to/img".
+type swwwSource struct{}
+
+func (swwwSource) Name() string { return "swww" }
+
+func (swwwSource) Running() bool { return isProcessRunning("swww-daemon") }
+
+func (swwwSource) Wallpapers() (map[string]string, error) {
+	output, err := exec.Command("swww", "query").Output()
+	if err != nil {
+		return nil, fmt.Errorf("swww query: %w", err)
+	}
+
+	wallpapers := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		// Newer releases prefix every line with ": ".
+		line = strings.TrimPrefix(strings.TrimSpace(line), ": ")
+
+		idx := strings.Index(line, "image: ")
+		if idx < 0 {
+			continue
+		}
+		monitorName, _, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		wallpapers[strings.TrimSpace(monitorName)] = strings.TrimSpace(line[idx+len("image: "):])
+	}
+	return wallpapers, nil
+}
+
+// wpaperdSource parses `wpaperctl all-wallpapers`, which prints
+// "monitor: path" lines.
+type wpaperdSource struct{}
+
+func (wpaperdSource) Name() string { return "wpaperd" }
+
+func (wpaperdSource) Running() bool { return isProcessRunning("wpaperd") }
+
+func (wpaperdSource) Wallpapers() (map[string]string, error) {
+	output, err := exec.Command("wpaperctl", "all-wallpapers").Output()
+	if err != nil {
+		return nil, fmt.Errorf("wpaperctl all-wallpapers: %w", err)
+	}
+	return parseMonitorLines(string(output), ":"), nil
+}
+
+// swaybgSource has no query interface, so it reads the -o/-i pairs from the
+// command line of every running swaybg process.
+type swaybgSource struct{}
+
+func (swaybgSource) Name() string { return "swaybg" }
+
+func (swaybgSource) Running() bool { return isProcessRunning("swaybg") }
+
+func (swaybgSource) Wallpapers() (map[string]string, error) {
+	wallpapers := make(map[string]string)
+	for _, args := range findProcessArgs("swaybg") {
+		output := allOutputsMonitor
+		for i := 1; i < len(args)-1; i++ {
+			switch args[i] {
+			case "-o", "--output":
+				output = args[i+1]
+				if output == "*" {
+					output = allOutputsMonitor
+				}
+				i++
+			case "-i", "--image":
+				wallpapers[output] = expandHome(args[i+1])
+				i++
+			}
+		}
+	}
+	return wallpapers, nil
+}
+
+// mpvpaperSource reads "mpvpaper [options] <output> <file>" from the
+// command line of every running mpvpaper process. Video files are reported
+// as-is and will fail to decode when colors are extracted.
+type mpvpaperSource struct{}
+
+func (mpvpaperSource) Name() string { return "mpvpaper" }
+
+func (mpvpaperSource) Running() bool { return isProcessRunning("mpvpaper") }
+
+func (mpvpaperSource) Wallpapers() (map[string]string, error) {
+	// Options that consume the following argument.
+	withValue := map[string]bool{
+		"-o": true, "--mpv-options": true,
+		"-l": true, "--layer": true,
+		"-n": true, "--slideshow": true,
+	}
+
+	wallpapers := make(map[string]string)
+	for _, args := range findProcessArgs("mpvpaper") {
+		var positional []string
+		for i := 1; i < len(args); i++ {
+			if withValue[args[i]] {
+				i++
+				continue
+			}
+			if strings.HasPrefix(args[i], "-") {
+				continue
+			}
+			positional = append(positional, args[i])
+		}
+		if len(positional) < 2 {
+			continue
+		}
+
+		output := positional[len(positional)-2]
+		if output == "*" || output == "ALL" {
+			output = allOutputsMonitor
+		}
+		wallpapers[output] = expandHome(positional[len(positional)-1])
+	}
+	return wallpapers, nil
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "watch - regenerate and rebuild themes whenever your wallpaper changes",
+	Run:   WatchWallpapers,
+}
+
+var (
+	watchInterval time.Duration
+	watchDebounce time.Duration
+)
+
+// hyprWatchEvents are the Hyprland events that can change which wallpaper a
+// monitor shows.
+var hyprWatchEvents = map[string]bool{
+	"monitoradded":   true,
+	"monitoraddedv2": true,
+	"monitorremoved": true,
+	"configreloaded": true,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVar(&wallpaperSourceName, "source", "auto",
+		"wallpaper daemon to query: auto, "+strings.Join(wallpaperSourceNames(), ", "))
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Second,
+		"how often to poll the wallpaper source (0 disables polling)")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 500*time.Millisecond,
+		"how long to wait after the last Hyprland event before rebuilding")
+	addBuildFlags(watchCmd)
+	addExtractionFlags(watchCmd)
+}
+
+func WatchWallpapers(cmd *cobra.Command, args []string) {
+	opts, err := buildClassifyOptions()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if err := validateExtractionFlags(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start from what is already on disk so an unchanged wallpaper is not
+	// rebuilt when the watcher starts.
+	current := make(map[string]MonitorInfo)
+	if monitors, err := loadThemeFile(); err == nil {
+		for _, monitor := range monitors {
+			current[monitor.Monitor] = monitor
+		}
+	}
+
+	triggers := make(chan struct{}, 1)
+	go watchHyprlandEvents(ctx, triggers)
+
+	var ticks <-chan time.Time
+	if watchInterval > 0 {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	// The debounce timer fires once immediately to sync on startup.
+	debounce := time.NewTimer(0)
+	defer debounce.Stop()
+
+	fmt.Println("Watching for wallpaper changes, press Ctrl+C to stop...")
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("\nStopped watching.")
+			return
+		case <-ticks:
+			// Polling is already spaced out, so it syncs without the
+			// debounce; resetting the timer on every tick would starve it
+			// when --debounce is longer than --interval.
+			syncWallpapers(current, opts)
+		case <-triggers:
+			debounce.Reset(watchDebounce)
+		case <-debounce.C:
+			syncWallpapers(current, opts)
+		}
+	}
+}
+
+// watchHyprlandEvents signals triggers whenever Hyprland reports a monitor
+// change. Without Hyprland the watcher relies on polling alone.
+func watchHyprlandEvents(ctx context.Context, triggers chan<- struct{}) {
+	client, err := NewHyprlandClient()
+	if err != nil {
+		return
+	}
+
+	for ctx.Err() == nil {
+		events, err := client.Events(ctx)
+		if err != nil {
+			log.Printf("Could not subscribe to Hyprland events: %v. Falling back to polling.", err)
+			return
+		}
+
+		for event := range events {
+			if !hyprWatchEvents[event.Name] {
+				continue
+			}
+			select {
+			case triggers <- struct{}{}:
+			default:
+			}
+		}
+
+		// The stream ended without cancellation; reconnect shortly.
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// syncWallpapers regenerates and rebuilds only the monitors whose wallpaper
+// path or content differs from current, and drops monitors that disappeared.
+func syncWallpapers(current map[string]MonitorInfo, opts classifyOptions) {
+	wallpapers, source, err := getWallpaper()
+	if err != nil {
+		log.Printf("ERROR: Could not get wallpaper: %v", err)
+		return
+	}
+
+	// A wallpaper also changed when a script overwrote the same file, so
+	// the content is compared too. Each file is hashed once per sync.
+	hashes := make(map[string]string)
+	stale := make(map[string]string)
+	for monitor, path := range wallpapers {
+		existing, ok := current[monitor]
+		if !ok || existing.Theme.WallpaperPath != path {
+			stale[monitor] = path
+			continue
+		}
+		hash, hashed := hashes[path]
+		if !hashed {
+			hash, _ = hashFile(path)
+			hashes[path] = hash
+		}
+		if hash != "" && hash != existing.Theme.WallpaperHash {
+			stale[monitor] = path
+		}
+	}
+
+	changed := extractMonitors(stale)
+	for i := range changed {
+		// A seed override belongs to the monitor, not the wallpaper
+		changed[i].Theme.Seed = current[changed[i].Monitor].Theme.Seed
+		current[changed[i].Monitor] = changed[i]
+	}
+
+	var removed []string
+	for monitor := range current {
+		if _, ok := wallpapers[monitor]; ok {
+			continue
+		}
+		fmt.Printf("Monitor %s is gone, removing its theme\n", monitor)
+		delete(current, monitor)
+		_ = os.RemoveAll(monitorThemeDir(monitor))
+		removed = append(removed, monitor)
+	}
+
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	monitors := make([]MonitorInfo, 0, len(current))
+	for _, info := range current {
+		monitors = append(monitors, info)
+	}
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].Monitor < monitors[j].Monitor
+	})
+
+	if _, _, err := writeThemeFile(monitors, source); err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+
+	// The global theme is made from every monitor, so it follows any change
+	if err := buildGlobalTheme(monitors, opts); err != nil {
+		log.Printf("ERROR: Could not build the global theme: %v", err)
+	}
+
+	// Monitors linked to the theme directory of a changed or removed monitor
+	// would follow it, so they are rebuilt as well
+	relinked := make(map[string]bool)
+	for _, monitor := range removed {
+		relinked[monitor] = true
+	}
+	for _, info := range changed {
+		relinked[info.Monitor] = true
+	}
+	rebuild := changed
+	for _, info := range monitors {
+		if target := themeLinkTarget(info.Monitor); relinked[target] && target != info.Monitor && !relinked[info.Monitor] {
+			rebuild = append(rebuild, info)
+		}
+	}
+	if len(rebuild) == 0 {
+		return
+	}
+	if err := buildMonitorThemes(rebuild, opts); err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	fmt.Printf("\nRebuilt themes for %d monitor(s) at %s\n", len(rebuild), time.Now().Format(time.TimeOnly))
+}
@@ -4,8 +4,10 @@ go 1.24.5
 
 require (
 	github.com/cascax/colorthief-go v0.0.0-20200408142718-f393563c12c5 // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/cobra v1.9.1 // indirect
 	github.com/spf13/pflag v1.0.7 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -4,6 +4,10 @@ import (
 	"archThemeM0d/cmd"
 )
 
+// Version is set at build time by build.sh with -ldflags "-X main.Version=...".
+var Version = "dev"
+
 func main() {
+	cmd.Version = Version
 	cmd.Execute()
 }